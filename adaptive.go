@@ -0,0 +1,87 @@
+package quicklog
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// AdaptiveTimeout sets each request's timeout from the latency of recent
+// requests: their 99th percentile times Factor, kept within Min and Max, so
+// requests fail faster when the API is fast and don't time out spuriously
+// when it is slow. Max defaults to the configured Client's Timeout, which is
+// also used until Window/10 requests have been seen. Timed-out requests count
+// with the time they took, so the timeout grows while the API is degraded.
+// Share one *AdaptiveTimeout through Config.
+type AdaptiveTimeout struct {
+	Min    time.Duration
+	Max    time.Duration
+	Factor float64 // default 3
+	Window int     // how many recent requests to keep; default 100
+
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+/**
+ * Returns the timeout for the next request.
+ * @return time.Duration
+ */
+func (a *AdaptiveTimeout) Timeout() time.Duration {
+	var clientTimeout time.Duration
+	if client := loadSettings().Client; client != nil {
+		clientTimeout = client.Timeout
+	}
+	return a.timeout(clientTimeout)
+}
+
+// timeout returns the timeout for the next request made with a client whose
+// Timeout is clientTimeout.
+func (a *AdaptiveTimeout) timeout(clientTimeout time.Duration) time.Duration {
+	max := a.Max
+	if max <= 0 {
+		max = clientTimeout
+	}
+	a.mu.Lock()
+	if len(a.samples) < a.window()/10 || len(a.samples) == 0 {
+		a.mu.Unlock()
+		return max
+	}
+	sorted := append([]time.Duration(nil), a.samples...)
+	a.mu.Unlock()
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	p99 := sorted[(len(sorted)*99-1)/100]
+	factor := a.Factor
+	if factor <= 0 {
+		factor = 3
+	}
+	timeout := time.Duration(float64(p99) * factor)
+	if timeout < a.Min {
+		timeout = a.Min
+	}
+	if max > 0 && timeout > max {
+		timeout = max
+	}
+	return timeout
+}
+
+func (a *AdaptiveTimeout) window() int {
+	if a.Window > 0 {
+		return a.Window
+	}
+	return 100
+}
+
+// observe records how long a request took.
+func (a *AdaptiveTimeout) observe(d time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.samples) < a.window() {
+		a.samples = append(a.samples, d)
+		return
+	}
+	a.samples[a.next] = d
+	a.next = (a.next + 1) % len(a.samples)
+}
@@ -0,0 +1,64 @@
+package quicklog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptiveTimeoutFollowsLatency(t *testing.T) {
+	a := &AdaptiveTimeout{Min: 100 * time.Millisecond, Max: 2 * time.Second, Factor: 2, Window: 100}
+	if got := a.timeout(3 * time.Second); got != a.Max {
+		t.Errorf("with no samples got %v, want Max %v", got, a.Max)
+	}
+
+	for i := 0; i < 100; i++ {
+		a.observe(time.Duration(i+1) * time.Millisecond)
+	}
+	// p99 is 99ms, times 2.
+	if got := a.timeout(3 * time.Second); got != 198*time.Millisecond {
+		t.Errorf("got %v, want 198ms", got)
+	}
+
+	for i := 0; i < 100; i++ {
+		a.observe(10 * time.Millisecond)
+	}
+	if got := a.timeout(3 * time.Second); got != a.Min {
+		t.Errorf("fast API got %v, want Min %v", got, a.Min)
+	}
+
+	for i := 0; i < 100; i++ {
+		a.observe(5 * time.Second)
+	}
+	if got := a.timeout(3 * time.Second); got != a.Max {
+		t.Errorf("slow API got %v, want Max %v", got, a.Max)
+	}
+}
+
+func TestAdaptiveTimeoutDefaultsToClientTimeout(t *testing.T) {
+	a := &AdaptiveTimeout{Min: 100 * time.Millisecond}
+	if got := a.timeout(3 * time.Second); got != 3*time.Second {
+		t.Errorf("with no samples got %v, want the client's 3s", got)
+	}
+	for i := 0; i < 100; i++ {
+		a.observe(10 * time.Second)
+	}
+	if got := a.timeout(3 * time.Second); got != 3*time.Second {
+		t.Errorf("got %v, want it capped at the client's 3s", got)
+	}
+
+	configureTest(t, nil, Config{ApiURL: "http://localhost", AdaptiveTimeout: &AdaptiveTimeout{}})
+	if got := (&AdaptiveTimeout{}).Timeout(); got != 3*time.Second {
+		t.Errorf("Timeout() got %v, want the default client's 3s", got)
+	}
+}
+
+func TestAdaptiveTimeoutRejectsMinAboveMax(t *testing.T) {
+	defer Configure(Config{})
+	err := Configure(Config{AdaptiveTimeout: &AdaptiveTimeout{Min: time.Second, Max: time.Millisecond}})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if CurrentConfig().AdaptiveTimeout != nil {
+		t.Error("invalid AdaptiveTimeout is still used")
+	}
+}
@@ -0,0 +1,50 @@
+package quicklog
+
+import (
+	"math"
+	"time"
+)
+
+// Backoff chooses how long to wait before a retry. attempt is 0 for the first retry.
+// A Retry-After header asking for longer still takes precedence.
+type Backoff interface {
+	NextDelay(attempt int) time.Duration
+}
+
+// ExponentialBackoff waits Initial (default 100ms), doubling on each attempt,
+// up to Max if it is set.
+type ExponentialBackoff struct {
+	Initial time.Duration
+	Max     time.Duration
+}
+
+func (b ExponentialBackoff) NextDelay(attempt int) time.Duration {
+	delay := b.Initial
+	if delay <= 0 {
+		delay = 100 * time.Millisecond
+	}
+	for i := 0; i < attempt; i++ {
+		if delay > math.MaxInt64/2 {
+			// Doubling again would overflow.
+			delay = math.MaxInt64
+			break
+		}
+		delay *= 2
+		if b.Max > 0 && delay >= b.Max {
+			break
+		}
+	}
+	if b.Max > 0 && delay > b.Max {
+		return b.Max
+	}
+	return delay
+}
+
+// ConstantBackoff always waits Delay.
+type ConstantBackoff struct {
+	Delay time.Duration
+}
+
+func (b ConstantBackoff) NextDelay(attempt int) time.Duration {
+	return b.Delay
+}
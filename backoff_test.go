@@ -0,0 +1,201 @@
+package quicklog
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// failingHandler responds with the given statuses in turn, then 200.
+func failingHandler(headers http.Header, statuses ...int) func(http.ResponseWriter, *http.Request, []byte) {
+	var mu sync.Mutex
+	return func(w http.ResponseWriter, r *http.Request, body []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(statuses) == 0 {
+			return
+		}
+		for k, v := range headers {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(statuses[0])
+		statuses = statuses[1:]
+	}
+}
+
+func TestRetries(t *testing.T) {
+	s := newTestServer(t)
+	s.Handler = failingHandler(nil, http.StatusInternalServerError, http.StatusTooManyRequests)
+	configureTest(t, s, Config{MaxRetries: 2, Backoff: ConstantBackoff{Delay: time.Millisecond}})
+	if err := Log(Entry{Action: "a", Ctx: TraceCtx("", "", "")}); err != nil {
+		t.Fatal(err)
+	}
+	entries := s.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("got %d attempts, want 3", len(entries))
+	}
+	if entries[0]["span_id"] != entries[2]["span_id"] {
+		t.Error("a retry changed the span ID")
+	}
+}
+
+func TestRetriesStopOnClientErrors(t *testing.T) {
+	s := newTestServer(t)
+	s.Handler = failingHandler(nil, http.StatusBadRequest)
+	configureTest(t, s, Config{MaxRetries: 2, Backoff: ConstantBackoff{Delay: time.Millisecond}})
+	if err := Log(Entry{Action: "a", Ctx: TraceCtx("", "", "")}); err == nil {
+		t.Fatal("expected the 400 to be returned")
+	}
+	if len(s.Entries()) != 1 {
+		t.Errorf("got %d attempts, want 1", len(s.Entries()))
+	}
+}
+
+func TestRetryAfterIsHonored(t *testing.T) {
+	s := newTestServer(t)
+	s.Handler = failingHandler(http.Header{"Retry-After": {"1"}}, http.StatusServiceUnavailable)
+	configureTest(t, s, Config{MaxRetries: 1, Backoff: ConstantBackoff{Delay: time.Millisecond}})
+	var waits []time.Duration
+	retrySleep = func(ctx context.Context, d time.Duration) bool {
+		waits = append(waits, d)
+		return true
+	}
+	defer func() { retrySleep = defaultRetrySleep }()
+	if err := Log(Entry{Action: "a", Ctx: TraceCtx("", "", "")}); err != nil {
+		t.Fatal(err)
+	}
+	if len(waits) != 1 || waits[0] != time.Second {
+		t.Errorf("waited %v, want the 1s Retry-After", waits)
+	}
+}
+
+var defaultRetrySleep = retrySleep
+
+func TestRetryAfter(t *testing.T) {
+	if d := retryAfter("3"); d != 3*time.Second {
+		t.Errorf("got %v for delta-seconds", d)
+	}
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if d := retryAfter(date); d <= 50*time.Second || d > time.Minute {
+		t.Errorf("got %v for an HTTP-date a minute away", d)
+	}
+	for _, value := range []string{"", "-1", "soon"} {
+		if d := retryAfter(value); d != 0 {
+			t.Errorf("got %v for %q", d, value)
+		}
+	}
+}
+
+func TestRetriesResendTheSameBody(t *testing.T) {
+	s := newTestServer(t)
+	var mu sync.Mutex
+	var bodies []string
+	fail := failingHandler(nil, http.StatusBadGateway, http.StatusBadGateway)
+	s.Handler = func(w http.ResponseWriter, r *http.Request, body []byte) {
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		fail(w, r, body)
+	}
+	configureTest(t, s, Config{MaxRetries: 2, Backoff: ConstantBackoff{}})
+	if err := Log(Entry{Published: time.Now(), Action: "a", Ctx: TraceCtx("", "", "")}); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 3 || bodies[0] != bodies[1] || bodies[1] != bodies[2] {
+		t.Errorf("attempts sent different bodies: %q", bodies)
+	}
+}
+
+func TestRedirectsResendTheBody(t *testing.T) {
+	s := newTestServer(t)
+	s.Handler = func(w http.ResponseWriter, r *http.Request, body []byte) {
+		if r.URL.Path == "/entries" {
+			http.Redirect(w, r, "/entries/moved", http.StatusTemporaryRedirect)
+		}
+	}
+	configureTest(t, s, Config{})
+	if err := Log(Entry{Published: time.Now(), Action: "a", Ctx: TraceCtx("", "", "")}); err != nil {
+		t.Fatal(err)
+	}
+	entries := s.Entries()
+	if len(entries) != 2 || entries[1]["type"] != "a" || entries[0]["span_id"] != entries[1]["span_id"] {
+		t.Errorf("got %v, want the whole entry posted again after the redirect", entries)
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	b := ExponentialBackoff{Initial: 10 * time.Millisecond, Max: 50 * time.Millisecond}
+	for attempt, want := range []time.Duration{10, 20, 40, 50, 50} {
+		if got := b.NextDelay(attempt); got != want*time.Millisecond {
+			t.Errorf("attempt %d: got %v, want %v", attempt, got, want*time.Millisecond)
+		}
+	}
+	if got := (ExponentialBackoff{}).NextDelay(0); got != 100*time.Millisecond {
+		t.Errorf("got default initial delay %v", got)
+	}
+	if got := (ExponentialBackoff{Initial: time.Second}).NextDelay(100); got <= 0 {
+		t.Errorf("a large attempt overflowed to %v", got)
+	}
+}
+
+// recordingBackoff records the attempts it is asked about.
+type recordingBackoff struct {
+	mu       sync.Mutex
+	attempts []int
+}
+
+func (b *recordingBackoff) NextDelay(attempt int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.attempts = append(b.attempts, attempt)
+	return time.Millisecond
+}
+
+func TestCustomBackoff(t *testing.T) {
+	s := newTestServer(t)
+	s.Handler = failingHandler(nil, http.StatusBadGateway, http.StatusBadGateway)
+	backoff := &recordingBackoff{}
+	configureTest(t, s, Config{MaxRetries: 2, Backoff: backoff})
+	if err := Log(Entry{Action: "a", Ctx: TraceCtx("", "", "")}); err != nil {
+		t.Fatal(err)
+	}
+	if len(backoff.attempts) != 2 || backoff.attempts[0] != 0 || backoff.attempts[1] != 1 {
+		t.Errorf("Backoff asked about attempts %v, want [0 1]", backoff.attempts)
+	}
+}
+
+func TestDisableEntryRetries(t *testing.T) {
+	s := newTestServer(t)
+	s.Handler = failingHandler(nil, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	configureTest(t, s, Config{MaxRetries: 1, DisableEntryRetries: true, Backoff: ConstantBackoff{}})
+	traceCtx := TraceCtx("", "", "")
+	if err := Log(Entry{Action: "a", Ctx: traceCtx}); err == nil {
+		t.Error("expected the entry to fail without a retry")
+	}
+	if err := TagTrace(traceCtx.TraceID, "t"); err != nil {
+		t.Errorf("the tag wasn't retried: %v", err)
+	}
+	if len(s.Entries()) != 1 || len(s.Tags()) != 2 {
+		t.Errorf("got %d entry and %d tag attempts, want 1 and 2", len(s.Entries()), len(s.Tags()))
+	}
+}
+
+func TestDisableTagRetries(t *testing.T) {
+	s := newTestServer(t)
+	s.Handler = func(w http.ResponseWriter, r *http.Request, body []byte) {
+		if r.URL.Path == "/tags" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}
+	configureTest(t, s, Config{MaxRetries: 1, DisableTagRetries: true, Backoff: ConstantBackoff{}})
+	if err := TagTrace(TraceCtx("", "", "").TraceID, "t"); err == nil {
+		t.Error("expected the tag to fail")
+	}
+	if len(s.Tags()) != 1 {
+		t.Errorf("got %d tag attempts, want 1", len(s.Tags()))
+	}
+}
@@ -0,0 +1,51 @@
+package quicklog
+
+import "encoding/base64"
+
+const binaryKey = "_b64"
+
+// encodeBinary replaces []byte values, at any depth of maps and slices, with
+// {"_b64": "<standard base64>"}. It reports whether anything was replaced,
+// and only copies the maps and slices it changes.
+func encodeBinary(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case []byte:
+		return map[string]string{binaryKey: base64.StdEncoding.EncodeToString(v)}, true
+	case map[string]interface{}:
+		var result map[string]interface{}
+		for k, item := range v {
+			encoded, changed := encodeBinary(item)
+			if !changed {
+				continue
+			}
+			if result == nil {
+				result = make(map[string]interface{}, len(v))
+				for k2, item2 := range v {
+					result[k2] = item2
+				}
+			}
+			result[k] = encoded
+		}
+		if result == nil {
+			return v, false
+		}
+		return result, true
+	case []interface{}:
+		var result []interface{}
+		for i, item := range v {
+			encoded, changed := encodeBinary(item)
+			if !changed {
+				continue
+			}
+			if result == nil {
+				result = append([]interface{}(nil), v...)
+			}
+			result[i] = encoded
+		}
+		if result == nil {
+			return v, false
+		}
+		return result, true
+	}
+	return v, false
+}
@@ -0,0 +1,35 @@
+package quicklog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBinaryExtra(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{})
+	nested := []interface{}{"text", []byte{0xff}}
+	extra := map[string]interface{}{"raw": []byte("hi"), "nested": map[string]interface{}{"list": nested}}
+	if err := Quicklog(time.Now(), "a", "", "", extra, TraceCtx("", "", "")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := nested[1].([]byte); !ok {
+		t.Error("the caller's slice was modified")
+	}
+	context := s.Entries()[0]["context"].(map[string]interface{})
+	if raw := context["raw"].(map[string]interface{}); raw[binaryKey] != "aGk=" {
+		t.Errorf("got raw %v", raw)
+	}
+	list := context["nested"].(map[string]interface{})["list"].([]interface{})
+	if list[0] != "text" || list[1].(map[string]interface{})[binaryKey] != "/w==" {
+		t.Errorf("got list %v", list)
+	}
+
+	configureTest(t, s, Config{RawBinary: true})
+	if err := Quicklog(time.Now(), "a", "", "", extra, TraceCtx("", "", "")); err != nil {
+		t.Fatal(err)
+	}
+	if raw := s.Entries()[1]["context"].(map[string]interface{})["raw"]; raw != "aGk=" {
+		t.Errorf("got raw %v with RawBinary", raw)
+	}
+}
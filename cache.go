@@ -0,0 +1,94 @@
+package quicklog
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache remembers keys for the tag cache (Config.TagCache) and entry
+// deduplication (Config.DedupeCache). The default is an in-memory LRU; an
+// adapter for a shared store, e.g. Redis SET NX with an expiry, lets short-lived
+// processes share them. Keys are prefixed with "quicklog:tag:" or
+// "quicklog:dedupe:". Implementations must be safe for concurrent use.
+type Cache interface {
+	// Has reports whether key is present and not expired.
+	Has(key string) bool
+	// Add adds key, expiring it after ttl unless ttl is zero, and reports
+	// whether it was absent. It should be atomic, so that of concurrent Adds
+	// of a key just one returns true.
+	Add(key string, ttl time.Duration) bool
+	// Remove removes key.
+	Remove(key string)
+}
+
+// lruCache is a Cache of at most size keys, forgetting the least recently used.
+type lruCache struct {
+	size  int
+	mu    sync.Mutex
+	order *list.List
+	items map[string]*list.Element
+}
+
+type lruItem struct {
+	key     string
+	expires time.Time // zero if never
+}
+
+// cacheNow is the clock of lruCache expiries, replaced in tests.
+var cacheNow = time.Now
+
+func newLRUCache(size int) *lruCache {
+	return &lruCache{size: size, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *lruCache) Has(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.has(key, cacheNow())
+}
+
+// has reports whether key is present, marking it as recently used and
+// removing it if it has expired. c.mu must be held.
+func (c *lruCache) has(key string, now time.Time) bool {
+	el, ok := c.items[key]
+	if !ok {
+		return false
+	}
+	if expires := el.Value.(*lruItem).expires; !expires.IsZero() && now.After(expires) {
+		c.order.Remove(el)
+		delete(c.items, key)
+		return false
+	}
+	c.order.MoveToFront(el)
+	return true
+}
+
+func (c *lruCache) Add(key string, ttl time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := cacheNow()
+	if c.has(key, now) {
+		return false
+	}
+	item := &lruItem{key: key}
+	if ttl > 0 {
+		item.expires = now.Add(ttl)
+	}
+	c.items[key] = c.order.PushFront(item)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruItem).key)
+	}
+	return true
+}
+
+func (c *lruCache) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.order.Remove(el)
+		delete(c.items, key)
+	}
+}
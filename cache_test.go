@@ -0,0 +1,141 @@
+package quicklog
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLRUCache(t *testing.T) {
+	c := newLRUCache(2)
+	if !c.Add("a", 0) || c.Add("a", 0) {
+		t.Fatal("Add didn't report whether the key was absent")
+	}
+	c.Add("b", 0)
+	c.Has("a")
+	c.Add("c", 0)
+	if !c.Has("a") || c.Has("b") || !c.Has("c") {
+		t.Error("the least recently used key wasn't the one evicted")
+	}
+	c.Remove("a")
+	if c.Has("a") {
+		t.Error("Remove didn't remove the key")
+	}
+	c.Add("d", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if c.Has("d") || !c.Add("d", 0) {
+		t.Error("the key didn't expire")
+	}
+}
+
+func TestTagCache(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{TagCacheSize: 10})
+	traceCtx := TraceCtx("", "", "")
+	for i := 0; i < 3; i++ {
+		if err := TagTrace(traceCtx.TraceID, "a", "b"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := TagTraceProject(777, traceCtx.TraceID, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Tags()) != 3 {
+		t.Errorf("sent %d tags, want a, b and a for the other project", len(s.Tags()))
+	}
+}
+
+func TestTagCacheForgetsFailedTags(t *testing.T) {
+	s := newTestServer(t)
+	s.Handler = failingHandler(nil, http.StatusBadRequest)
+	configureTest(t, s, Config{TagCacheSize: 10})
+	traceCtx := TraceCtx("", "", "")
+	if err := TagTrace(traceCtx.TraceID, "a"); err == nil {
+		t.Fatal("expected the 400")
+	}
+	if err := TagTrace(traceCtx.TraceID, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Tags()) != 2 {
+		t.Errorf("sent %d tags, want the failed tag sent again", len(s.Tags()))
+	}
+}
+
+// mapCache is a Cache recording the keys it is asked to add and remove.
+type mapCache struct {
+	mu      sync.Mutex
+	keys    map[string]bool
+	added   []string
+	removed []string
+}
+
+func (c *mapCache) Has(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.keys[key]
+}
+
+func (c *mapCache) Add(key string, ttl time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.added = append(c.added, key)
+	if c.keys[key] {
+		return false
+	}
+	c.keys[key] = true
+	return true
+}
+
+func (c *mapCache) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removed = append(c.removed, key)
+	delete(c.keys, key)
+}
+
+func TestCustomCaches(t *testing.T) {
+	s := newTestServer(t)
+	s.Handler = failingHandler(nil, http.StatusBadRequest)
+	dedupe, tags := &mapCache{keys: map[string]bool{}}, &mapCache{keys: map[string]bool{}}
+	configureTest(t, s, Config{DedupeWindow: time.Minute, DedupeCache: dedupe, TagCache: tags})
+	traceCtx := TraceCtx("", "", "")
+	for i := 0; i < 3; i++ {
+		err := Log(Entry{Action: "a", DedupeKey: "order:1", Ctx: traceCtx})
+		if (err != nil) != (i == 0) {
+			t.Fatalf("attempt %d: got %v, want only the first to fail", i, err)
+		}
+	}
+	if len(s.Entries()) != 2 || len(dedupe.added) != 3 || len(dedupe.removed) != 1 || !dedupe.Has(dedupe.removed[0]) {
+		t.Errorf("sent %d entries with keys added %v and removed %v, want the failed one retried then skipped", len(s.Entries()), dedupe.added, dedupe.removed)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := TagTrace(traceCtx.TraceID, "t"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(s.Tags()) != 1 || len(tags.keys) != 1 {
+		t.Errorf("sent %d tags with cache keys %v, want one", len(s.Tags()), tags.keys)
+	}
+}
+
+func TestSharedDedupeCache(t *testing.T) {
+	// Two instances, e.g. short-lived processes, sharing one store.
+	shared := &mapCache{keys: map[string]bool{}}
+	first, second := newTestServer(t), newTestServer(t)
+	configureTest(t, first, Config{DedupeWindow: time.Minute, DedupeCache: shared})
+	if err := Log(Entry{Action: "a", DedupeKey: "order:1", Ctx: TraceCtx("", "", "")}); err != nil {
+		t.Fatal(err)
+	}
+	configureTest(t, second, Config{DedupeWindow: time.Minute, DedupeCache: shared})
+	if err := Log(Entry{Action: "a", DedupeKey: "order:1", Ctx: TraceCtx("", "", "")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Log(Entry{Action: "a", DedupeKey: "order:2", Ctx: TraceCtx("", "", "")}); err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Entries()) != 1 || len(second.Entries()) != 1 || second.Entries()[0]["type"] != "a" {
+		t.Errorf("sent %d and %d entries, want the second instance to skip order:1", len(first.Entries()), len(second.Entries()))
+	}
+}
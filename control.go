@@ -0,0 +1,62 @@
+package quicklog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ControlCharPolicy is what to do with control characters (U+0000 to U+001F
+// and U+007F) in an entry's action, object, target and actor.
+type ControlCharPolicy int
+
+const (
+	ControlCharsAllow  ControlCharPolicy = iota // send them (JSON-escaped) unchanged
+	ControlCharsReject                          // return an error
+	ControlCharsStrip                           // remove them
+	ControlCharsEscape                          // replace each with the text \u00XX
+)
+
+func isControl(r rune) bool {
+	return r < 0x20 || r == 0x7f
+}
+
+// checkControlChars applies Config.ControlChars to e's string fields.
+func checkControlChars(cfg *settings, e *Entry) error {
+	policy := cfg.ControlChars
+	if policy == ControlCharsAllow {
+		return nil
+	}
+	fields := []struct {
+		name  string
+		value *string
+	}{
+		{"type", &e.Action},
+		{"object", &e.Object},
+		{"target", &e.Target},
+		{"actor", &e.Ctx.ActorID},
+	}
+	for _, f := range fields {
+		i := strings.IndexFunc(*f.value, isControl)
+		if i < 0 {
+			continue
+		}
+		if policy == ControlCharsReject {
+			return fmt.Errorf("'%s' has control character %q at offset %d", f.name, (*f.value)[i], i)
+		}
+		*f.value = sanitizeControl(*f.value, policy)
+	}
+	return nil
+}
+
+func sanitizeControl(s string, policy ControlCharPolicy) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case !isControl(r):
+			b.WriteRune(r)
+		case policy == ControlCharsEscape:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		}
+	}
+	return b.String()
+}
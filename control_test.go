@@ -0,0 +1,39 @@
+package quicklog
+
+import "testing"
+
+func TestControlChars(t *testing.T) {
+	for _, test := range []struct {
+		policy ControlCharPolicy
+		want   string
+	}{
+		{ControlCharsAllow, "a\nb\x7f"},
+		{ControlCharsStrip, "ab"},
+		{ControlCharsEscape, `a\u000ab\u007f`},
+	} {
+		s := newTestServer(t)
+		configureTest(t, s, Config{ControlChars: test.policy})
+		if err := Log(Entry{Action: "a\nb\x7f", Object: "object:1", Ctx: TraceCtx("user:\t1", "", "")}); err != nil {
+			t.Fatal(err)
+		}
+		e := s.Entries()[0]
+		if e["type"] != test.want || e["object"] != "object:1" {
+			t.Errorf("policy %d: got type %q, want %q", test.policy, e["type"], test.want)
+		}
+		if test.policy == ControlCharsStrip && e["actor"] != "user:1" {
+			t.Errorf("got actor %q", e["actor"])
+		}
+	}
+
+	s := newTestServer(t)
+	configureTest(t, s, Config{ControlChars: ControlCharsReject})
+	if err := Log(Entry{Action: "a", Target: "target:\x001", Ctx: TraceCtx("", "", "")}); err == nil {
+		t.Error("a control character was accepted")
+	}
+	if err := Log(Entry{Action: "a", Target: "target:1", Ctx: TraceCtx("", "", "")}); err != nil {
+		t.Error(err)
+	}
+	if len(s.Entries()) != 1 {
+		t.Errorf("got %d entries, want 1", len(s.Entries()))
+	}
+}
@@ -0,0 +1,89 @@
+package quicklog
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// currentSpans holds the Ctx set by SetCurrentSpan, by goroutine ID.
+var (
+	currentSpans   = map[uint64]Ctx{}
+	currentSpansMu sync.Mutex
+)
+
+/**
+ * Sets the Ctx used by entries logged on the current goroutine without one
+ * (a Ctx with no TraceID), for code that can't easily be changed to pass a Ctx
+ * along. Call the returned function, typically with defer, when the work is
+ * done; it restores the previously set Ctx, if any. The Ctx doesn't follow
+ * the work into goroutines it starts: set it again there, or better, pass it.
+ * An entry's own Ctx always wins. Forgetting to clear it leaks the Ctx, and
+ * the goroutine's ID may later be reused by an unrelated goroutine.
+ * e.g. defer quicklog.SetCurrentSpan(traceCtx)()
+ * @param {Ctx} traceCtx
+ * @return func()
+ */
+func SetCurrentSpan(traceCtx Ctx) func() {
+	id := goroutineID()
+	currentSpansMu.Lock()
+	prev, hadPrev := currentSpans[id]
+	currentSpans[id] = traceCtx
+	currentSpansMu.Unlock()
+	return func() {
+		currentSpansMu.Lock()
+		if hadPrev {
+			currentSpans[id] = prev
+		} else {
+			delete(currentSpans, id)
+		}
+		currentSpansMu.Unlock()
+	}
+}
+
+/**
+ * Removes any Ctx set by SetCurrentSpan on the current goroutine.
+ */
+func ClearCurrentSpan() {
+	id := goroutineID()
+	currentSpansMu.Lock()
+	delete(currentSpans, id)
+	currentSpansMu.Unlock()
+}
+
+/**
+ * Returns the Ctx set by SetCurrentSpan on the current goroutine, if any.
+ * @return Ctx, bool
+ */
+func CurrentSpan() (Ctx, bool) {
+	currentSpansMu.Lock()
+	defer currentSpansMu.Unlock()
+	if len(currentSpans) == 0 {
+		return Ctx{}, false
+	}
+	traceCtx, ok := currentSpans[goroutineID()]
+	return traceCtx, ok
+}
+
+// withCurrentSpan gives e the current goroutine's Ctx if it has none.
+func withCurrentSpan(e *Entry) {
+	if e.Ctx.TraceID != "" {
+		return
+	}
+	if traceCtx, ok := CurrentSpan(); ok {
+		e.Ctx = traceCtx
+	}
+}
+
+// goroutineID parses the ID from the "goroutine N [running]:" line of the stack.
+func goroutineID() uint64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
@@ -0,0 +1,49 @@
+package quicklog
+
+import "testing"
+
+func TestCurrentSpan(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{})
+	outer, inner := TraceCtx("", "", ""), TraceCtx("", "", "")
+
+	restore := SetCurrentSpan(outer)
+	restoreInner := SetCurrentSpan(inner)
+	if c, ok := CurrentSpan(); !ok || c.SpanID != inner.SpanID {
+		t.Errorf("got %+v, %v, want the inner span", c, ok)
+	}
+	if err := Log(Entry{Action: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	other := TraceCtx("", "", "")
+	if err := Log(Entry{Action: "a", Ctx: other}); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan bool)
+	go func() {
+		_, ok := CurrentSpan()
+		done <- ok
+	}()
+	if <-done {
+		t.Error("another goroutine got the current span")
+	}
+
+	restoreInner()
+	if c, ok := CurrentSpan(); !ok || c.SpanID != outer.SpanID {
+		t.Errorf("got %+v, %v, want the outer span restored", c, ok)
+	}
+	restore()
+	if _, ok := CurrentSpan(); ok {
+		t.Error("a span is still set after restoring")
+	}
+	SetCurrentSpan(outer)
+	ClearCurrentSpan()
+	if _, ok := CurrentSpan(); ok {
+		t.Error("ClearCurrentSpan didn't clear the span")
+	}
+
+	entries := s.Entries()
+	if len(entries) != 2 || entries[0]["span_id"] != inner.SpanID || entries[1]["span_id"] != other.SpanID {
+		t.Errorf("got entries %v, want the current span then the entry's own", entries)
+	}
+}
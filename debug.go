@@ -0,0 +1,70 @@
+package quicklog
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// debugState is the JSON written by DebugHandler.
+type debugState struct {
+	Disabled      bool          `json:"disabled"`
+	Detached      int           `json:"detached"`
+	MaxDetached   int           `json:"max_detached"`
+	QueuedTraces  int           `json:"queued_traces"`
+	InFlight      int           `json:"in_flight"`
+	MaxInFlight   int           `json:"max_in_flight,omitempty"`
+	QueuedSamples []debugSample `json:"queued_sample,omitempty"`
+}
+
+// debugSample describes a queued entry without its object, target or extra.
+type debugSample struct {
+	Action    string    `json:"type"`
+	Published time.Time `json:"published"`
+	TraceID   string    `json:"trace_id"`
+	SpanID    string    `json:"span_id"`
+}
+
+/**
+ * Returns an http.Handler writing JSON describing the LogDetached entries not
+ * yet sent (detached, of max_detached, with queued_traces traces having
+ * entries waiting behind a send), the requests in flight, and whether sending
+ * is disabled. A 'sample=N' query parameter adds up to N queued entries, with
+ * only their type, published time and IDs. Mount it on an internal admin port,
+ * not a public one.
+ * @return http.Handler
+ */
+func DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sample, _ := strconv.Atoi(r.URL.Query().Get("sample"))
+		cfg := loadSettings()
+		state := debugState{
+			Disabled:    isDisabled(),
+			Detached:    len(cfg.detachedSlots),
+			MaxDetached: cap(cfg.detachedSlots),
+			InFlight:    len(cfg.inFlightSlots),
+			MaxInFlight: cap(cfg.inFlightSlots),
+		}
+		detachedMu.Lock()
+		for _, queue := range detachedQueues {
+			if len(queue) > 0 {
+				state.QueuedTraces++
+			}
+			for _, d := range queue {
+				if len(state.QueuedSamples) >= sample {
+					break
+				}
+				state.QueuedSamples = append(state.QueuedSamples, debugSample{
+					Action:    d.e.Action,
+					Published: d.e.Published,
+					TraceID:   d.e.Ctx.TraceID,
+					SpanID:    d.e.Ctx.SpanID,
+				})
+			}
+		}
+		detachedMu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(state)
+	})
+}
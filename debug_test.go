@@ -0,0 +1,53 @@
+package quicklog
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDebugHandlerCountsQueuedTraces(t *testing.T) {
+	s := newTestServer(t)
+	release := make(chan struct{})
+	s.Handler = func(w http.ResponseWriter, r *http.Request, body []byte) { <-release }
+	configureTest(t, s, Config{})
+
+	queued := TraceCtx("", "", "")
+	for i := 0; i < 3; i++ {
+		LogDetached("queued", "", "", nil, queued)
+	}
+	LogDetached("alone", "", "", nil, TraceCtx("", "", ""))
+
+	get := func(query string) debugState {
+		rec := httptest.NewRecorder()
+		DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/"+query, nil))
+		var state debugState
+		if err := json.Unmarshal(rec.Body.Bytes(), &state); err != nil {
+			t.Fatal(err)
+		}
+		return state
+	}
+	state := get("?sample=10")
+	if state.Detached != 4 || state.QueuedTraces != 1 || len(state.QueuedSamples) != 2 {
+		t.Fatalf("got %+v, want 4 detached with 2 queued behind a send in 1 trace", state)
+	}
+	if sample := state.QueuedSamples[0]; sample.Action != "queued" || sample.TraceID != queued.TraceID || sample.SpanID != queued.SpanID {
+		t.Errorf("got sample %+v", sample)
+	}
+	if state := get("?sample=1"); len(state.QueuedSamples) != 1 {
+		t.Errorf("got %d samples, want 1", len(state.QueuedSamples))
+	}
+	if state := get(""); len(state.QueuedSamples) != 0 || state.Disabled {
+		t.Errorf("got %+v, want no samples unless asked for", state)
+	}
+	close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,125 @@
+package quicklog
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var (
+	detachedMu sync.Mutex
+	// detachedQueues has an entry for each trace with a detached send running,
+	// holding the entries for that trace waiting to be sent after it.
+	detachedQueues = make(map[string][]detachedEntry)
+	// detachedPending counts the detached entries not yet sent, under any
+	// settings, for Close to wait on.
+	detachedPending sync.WaitGroup
+)
+
+type detachedEntry struct {
+	e Entry
+	// cfg is the settings when the entry was logged, used to send it.
+	cfg *settings
+}
+
+/**
+ * Sends an entry, published now, in the background without waiting for it.
+ * The send is bounded by Config.DetachTimeout (default 5s), and at most
+ * Config.MaxDetached (default 64) entries may be waiting or being sent:
+ * beyond that the entry is dropped. Failures and drops are reported to
+ * Config.ErrorLog.
+ *
+ * Entries for the same trace are sent one at a time in the order LogDetached
+ * was called; entries for different traces are sent concurrently. Each entry
+ * is sent with the settings in effect when LogDetached was called, even if
+ * Configure is called again before it is sent.
+ * @return nothing
+ */
+func LogDetached(action, object, target string, extra map[string]interface{}, traceCtx Ctx, tags ...string) {
+	logDetached(Entry{Published: time.Now(), Action: action, Object: object, Target: target, Extra: extra, Ctx: traceCtx, Tags: tags})
+}
+
+/**
+ * Same as LogDetached for an Entry, e.g. one with OnDelivered set.
+ * @param {Entry} e
+ */
+func LogEntryDetached(e Entry) {
+	logDetached(e)
+}
+
+func logDetached(e Entry) {
+	logDetachedWith(loadSettings(), e)
+}
+
+func logDetachedWith(cfg *settings, e Entry) {
+	// Checked now, not when the entry is sent, as for the other calls.
+	if isDisabled() {
+		return
+	}
+	withCurrentSpan(&e)
+	if e.Published.IsZero() {
+		e.Published = time.Now()
+	}
+	slots := cfg.detachedSlots
+	select {
+	case slots <- struct{}{}:
+	default:
+		logf("quicklog: dropped %q entry, %d detached entries already pending", e.Action, cap(slots))
+		reportMeta("drop", map[string]interface{}{"action": e.Action, "reason": "too many detached entries"})
+		if e.OnDelivered != nil {
+			go e.OnDelivered(ErrDropped)
+		}
+		return
+	}
+	detachedPending.Add(1)
+
+	d := detachedEntry{e: e, cfg: cfg}
+	if traceID := e.Ctx.TraceID; traceID != "" {
+		detachedMu.Lock()
+		if queue, running := detachedQueues[traceID]; running {
+			detachedQueues[traceID] = append(queue, d)
+			detachedMu.Unlock()
+			return
+		}
+		detachedQueues[traceID] = nil
+		detachedMu.Unlock()
+	}
+	go sendDetached(d)
+}
+
+// sendDetached sends d and then any entries queued behind it for the same trace.
+func sendDetached(d detachedEntry) {
+	for {
+		d.send()
+		traceID := d.e.Ctx.TraceID
+		if traceID == "" {
+			return
+		}
+		detachedMu.Lock()
+		queue := detachedQueues[traceID]
+		if len(queue) == 0 {
+			delete(detachedQueues, traceID)
+			detachedMu.Unlock()
+			return
+		}
+		d, detachedQueues[traceID] = queue[0], queue[1:]
+		detachedMu.Unlock()
+	}
+}
+
+func (d detachedEntry) send() {
+	defer func() {
+		<-d.cfg.detachedSlots
+		detachedPending.Done()
+	}()
+	timeout := d.cfg.DetachTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(withSettings(context.Background(), d.cfg), timeout)
+	defer cancel()
+	if err := LogContext(ctx, d.e); err != nil {
+		logf("quicklog: detached %q entry failed: %v", d.e.Action, err)
+		reportMeta("send_failure", map[string]interface{}{"action": d.e.Action, "error": err.Error()})
+	}
+}
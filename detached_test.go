@@ -0,0 +1,175 @@
+package quicklog
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLogDetachedKeepsSettingsAcrossConfigure(t *testing.T) {
+	s := newTestServer(t)
+	release := make(chan struct{})
+	s.Handler = func(w http.ResponseWriter, r *http.Request, body []byte) { <-release }
+	configureTest(t, s, Config{ProjectID: 1, Source: "before"})
+
+	for i := 0; i < 20; i++ {
+		LogDetached("queued", "", "", nil, TraceCtx("", "", ""))
+	}
+	configureTest(t, s, Config{ProjectID: 2, Source: "after"})
+	close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	entries := s.Entries()
+	if len(entries) != 20 {
+		t.Fatalf("got %d entries, want 20", len(entries))
+	}
+	for _, e := range entries {
+		if e["project_id"] != float64(1) || e["source"] != "before" {
+			t.Errorf("entry sent with the new settings: %v", e)
+		}
+	}
+}
+
+func TestCloseWaitsForEntriesFromEarlierSettings(t *testing.T) {
+	s := newTestServer(t)
+	release := make(chan struct{})
+	s.Handler = func(w http.ResponseWriter, r *http.Request, body []byte) { <-release }
+	configureTest(t, s, Config{MaxDetached: 4})
+
+	for i := 0; i < 4; i++ {
+		LogDetached("queued", "", "", nil, TraceCtx("", "", ""))
+	}
+	// A new MaxDetached gives the new settings their own, empty, slots.
+	configureTest(t, s, Config{MaxDetached: 8})
+	time.AfterFunc(50*time.Millisecond, func() { close(release) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(s.Entries()); n != 4 {
+		t.Errorf("Close returned with %d of 4 entries sent", n)
+	}
+}
+
+func TestLogDetachedDropsBeyondMaxDetached(t *testing.T) {
+	s := newTestServer(t)
+	release := make(chan struct{})
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	s.Handler = func(w http.ResponseWriter, r *http.Request, body []byte) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		<-release
+		mu.Lock()
+		running--
+		mu.Unlock()
+	}
+	configureTest(t, s, Config{MaxDetached: 3, ErrorLog: log.New(ioutil.Discard, "", 0)})
+
+	var wg sync.WaitGroup
+	results := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			LogEntryDetached(Entry{Action: "a", Ctx: TraceCtx("", "", ""), OnDelivered: func(err error) { results <- err }})
+		}()
+	}
+	wg.Wait()
+	close(release)
+
+	dropped, delivered := 0, 0
+	for i := 0; i < 10; i++ {
+		select {
+		case err := <-results:
+			if err == ErrDropped {
+				dropped++
+			} else if err == nil {
+				delivered++
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for entries")
+		}
+	}
+	if delivered != 3 || dropped != 7 {
+		t.Errorf("delivered %d and dropped %d, want 3 and 7", delivered, dropped)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if maxRunning > 3 {
+		t.Errorf("%d sends ran at once, more than MaxDetached", maxRunning)
+	}
+}
+
+func TestLogDetachedTimeout(t *testing.T) {
+	s := newTestServer(t)
+	release := make(chan struct{})
+	defer close(release)
+	s.Handler = func(w http.ResponseWriter, r *http.Request, body []byte) { <-release }
+	var logged safeBuffer
+	configureTest(t, s, Config{DetachTimeout: 50 * time.Millisecond, ErrorLog: log.New(&logged, "", 0)})
+	result := make(chan error, 1)
+	LogEntryDetached(Entry{Action: "slow", Ctx: TraceCtx("", "", ""), OnDelivered: func(err error) { result <- err }})
+	select {
+	case err := <-result:
+		if err == nil {
+			t.Error("the send wasn't bounded by DetachTimeout")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("DetachTimeout didn't end the send")
+	}
+	waitFor(t, "the failure to be logged", func() bool { return strings.Contains(logged.String(), `detached "slow" entry failed`) })
+}
+
+func TestLogDetachedKeepsTraceOrder(t *testing.T) {
+	s := newTestServer(t)
+	blocked := TraceCtx("", "", "")
+	release := make(chan struct{})
+	s.Handler = func(w http.ResponseWriter, r *http.Request, body []byte) {
+		if strings.Contains(string(body), blocked.TraceID) {
+			<-release
+		}
+	}
+	configureTest(t, s, Config{})
+
+	LogDetached("blocked", "", "", nil, blocked)
+	ordered := TraceCtx("", "", "")
+	for i := 0; i < 20; i++ {
+		LogDetached("ordered", strconv.Itoa(i), "", nil, ordered.Child())
+	}
+	// The ordered trace isn't held up by the blocked one.
+	waitFor(t, "the ordered entries", func() bool { return len(s.Entries()) == 21 })
+	close(release)
+
+	i := 0
+	for _, e := range s.Entries() {
+		if e["type"] != "ordered" {
+			continue
+		}
+		if e["object"] != strconv.Itoa(i) {
+			t.Fatalf("entry %d sent as number %v", i, e["object"])
+		}
+		i++
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,221 @@
+package quicklog
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DiagnosticStage is the result of one step of Diagnose.
+type DiagnosticStage struct {
+	Name     string
+	OK       bool
+	Skipped  bool
+	Duration time.Duration
+	Detail   string
+}
+
+// DiagnosticReport is the result of Diagnose, with its stages in the order run.
+type DiagnosticReport struct {
+	URL    string
+	Stages []DiagnosticStage
+}
+
+// OK reports whether every stage succeeded.
+func (r DiagnosticReport) OK() bool {
+	for _, stage := range r.Stages {
+		if !stage.OK {
+			return false
+		}
+	}
+	return true
+}
+
+// Failed returns the first stage that failed, or nil.
+func (r DiagnosticReport) Failed() *DiagnosticStage {
+	for i := range r.Stages {
+		if !r.Stages[i].OK && !r.Stages[i].Skipped {
+			return &r.Stages[i]
+		}
+	}
+	return nil
+}
+
+func (r DiagnosticReport) String() string {
+	s := "quicklog diagnostics for " + r.URL + "\n"
+	for _, stage := range r.Stages {
+		status := "ok"
+		if stage.Skipped {
+			status = "skipped"
+		} else if !stage.OK {
+			status = "FAILED"
+		}
+		s += fmt.Sprintf("  %-8s %-7s %8v %s\n", stage.Name, status, stage.Duration.Round(time.Millisecond), stage.Detail)
+	}
+	return s
+}
+
+/**
+ * Checks the connection to the configured API one step at a time: DNS
+ * resolution, TCP connect, TLS handshake (for https), and a sample entry POST
+ * that also checks the ApiKey (401) and ProjectID permissions (403). Stages
+ * after a failure are marked as skipped. While sending is disabled, the config
+ * stage fails with ErrDisabled, so nothing is dialed or sent.
+ * @param {context.Context} ctx
+ * @return DiagnosticReport
+ */
+func Diagnose(ctx context.Context) DiagnosticReport {
+	cfg := loadSettings()
+	ctx = withSettings(ctx, cfg)
+	report := DiagnosticReport{URL: cfg.ApiURL}
+	failed := false
+	run := func(name string, fn func() (string, error)) {
+		if failed {
+			report.Stages = append(report.Stages, DiagnosticStage{Name: name, Skipped: true})
+			return
+		}
+		start := time.Now()
+		detail, err := fn()
+		stage := DiagnosticStage{Name: name, OK: err == nil, Duration: time.Since(start), Detail: detail}
+		if err != nil {
+			stage.Detail = err.Error()
+			failed = true
+		}
+		report.Stages = append(report.Stages, stage)
+	}
+
+	var u *url.URL
+	run("config", func() (string, error) {
+		if isDisabled() {
+			return "", ErrDisabled
+		}
+		if cfg.ProjectID == 0 {
+			return "", fmt.Errorf("ProjectID must be set in Config options")
+		}
+		if err := checkAPIConfig(cfg); err != nil {
+			return "", err
+		}
+		var err error
+		u, err = url.Parse(cfg.ApiURL)
+		if err == nil && u.Hostname() == "" {
+			err = fmt.Errorf("ApiURL %q has no host", cfg.ApiURL)
+		}
+		return "", err
+	})
+
+	var addrs []string
+	run("dns", func() (string, error) {
+		var err error
+		addrs, err = net.DefaultResolver.LookupHost(ctx, u.Hostname())
+		return fmt.Sprint(addrs), err
+	})
+
+	var conn net.Conn
+	run("connect", func() (string, error) {
+		port := u.Port()
+		if port == "" {
+			port = "80"
+			if u != nil && u.Scheme == "https" {
+				port = "443"
+			}
+		}
+		var err error
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", net.JoinHostPort(addrs[0], port))
+		if err != nil {
+			return "", err
+		}
+		return conn.RemoteAddr().String(), nil
+	})
+
+	if u != nil && u.Scheme == "https" {
+		run("tls", func() (string, error) {
+			tc := &tls.Config{ServerName: u.Hostname()}
+			if tr, ok := httpClient(ctx).Transport.(*http.Transport); ok && tr.TLSClientConfig != nil {
+				tc = tr.TLSClientConfig.Clone()
+				if tc.ServerName == "" {
+					tc.ServerName = u.Hostname()
+				}
+			}
+			tlsConn := tls.Client(conn, tc)
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				return "", err
+			}
+			state := tlsConn.ConnectionState()
+			return fmt.Sprintf("%s, %s", tlsVersionName(state.Version), tls.CipherSuiteName(state.CipherSuite)), nil
+		})
+	}
+	if conn != nil {
+		conn.Close()
+	}
+
+	run("post", func() (string, error) {
+		traceCtx := TraceCtx("", "", "")
+		body := entryBody{
+			ProjectID: cfg.ProjectID,
+			Source:    cfg.Source,
+			Type:      "quicklog.diagnose",
+			TraceID:   traceCtx.TraceID,
+			SpanID:    traceCtx.SpanID,
+		}
+		now := time.Now()
+		body.Published = &now
+		buf := getBuffer()
+		defer putBuffer(buf)
+		content, err := marshal(cfg, buf, body)
+		if err != nil {
+			return "", err
+		}
+		url, err := apiSink{}.endpoint(cfg, cfg.EntriesURL, "/entries")
+		if err != nil {
+			return "", err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(content))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", userAgent(cfg))
+		// Signed as entries are, so a signature the API rejects shows up here.
+		if cfg.RequestSigner != nil {
+			if err := cfg.RequestSigner(req, content); err != nil {
+				return "", fmt.Errorf("RequestSigner: %v", err)
+			}
+		}
+		resp, respBody, err := do(ctx, req)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized:
+			return "", fmt.Errorf("not authorized, check ApiKey: %v", statusError(resp, respBody))
+		case resp.StatusCode == http.StatusForbidden:
+			return "", fmt.Errorf("forbidden, check ApiKey has access to ProjectID %d: %v", cfg.ProjectID, statusError(resp, respBody))
+		case resp.StatusCode >= 300:
+			return "", statusError(resp, respBody)
+		}
+		return resp.Status, nil
+	})
+
+	return report
+}
+
+// tlsVersionName is tls.VersionName, which needs Go 1.21.
+func tlsVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	}
+	return fmt.Sprintf("0x%04X", version)
+}
@@ -0,0 +1,112 @@
+package quicklog
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiagnose(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{})
+	report := Diagnose(context.Background())
+	if !report.OK() {
+		t.Fatalf("diagnostics failed:\n%v", report)
+	}
+	if len(s.Entries()) != 1 {
+		t.Errorf("got %d sample entries, want 1", len(s.Entries()))
+	}
+}
+
+func TestDiagnoseWhileDisabled(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{})
+	Disable()
+	defer Enable()
+	report := Diagnose(context.Background())
+	if failed := report.Failed(); failed == nil || failed.Name != "config" || failed.Detail != ErrDisabled.Error() {
+		t.Errorf("got failed stage %+v, want config failing with ErrDisabled", failed)
+	}
+	if len(s.Requests()) != 0 {
+		t.Errorf("made %d requests while disabled", len(s.Requests()))
+	}
+}
+
+func TestDiagnoseSignsSamplePost(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{
+		RequestSigner: func(req *http.Request, body []byte) error {
+			req.Header.Set("X-Signature", strconv.Itoa(len(body)))
+			return nil
+		},
+	})
+	if report := Diagnose(context.Background()); !report.OK() {
+		t.Fatalf("diagnostics failed:\n%v", report)
+	}
+	reqs := s.Requests()
+	if len(reqs) != 1 || reqs[0].Header.Get("X-Signature") == "" {
+		t.Error("the sample POST wasn't signed")
+	}
+}
+
+func TestDiagnoseReportsAuthFailures(t *testing.T) {
+	s := newTestServer(t)
+	for status, want := range map[int]string{http.StatusUnauthorized: "check ApiKey", http.StatusForbidden: "access to ProjectID 12345"} {
+		status := status
+		s.Handler = func(w http.ResponseWriter, r *http.Request, body []byte) { w.WriteHeader(status) }
+		configureTest(t, s, Config{})
+		failed := Diagnose(context.Background()).Failed()
+		if failed == nil || failed.Name != "post" || !strings.Contains(failed.Detail, want) {
+			t.Errorf("%d: got failed stage %+v, want post mentioning %q", status, failed, want)
+		}
+	}
+}
+
+func TestDiagnoseSkipsStagesAfterAFailure(t *testing.T) {
+	configureTest(t, nil, Config{ApiURL: "http://"})
+	report := Diagnose(context.Background())
+	if failed := report.Failed(); failed == nil || failed.Name != "config" {
+		t.Fatalf("got failed stage %+v, want config", failed)
+	}
+	for _, stage := range report.Stages[1:] {
+		if !stage.Skipped {
+			t.Errorf("stage %s ran after config failed", stage.Name)
+		}
+	}
+	if report.OK() || !strings.Contains(report.String(), "skipped") {
+		t.Errorf("got report:\n%v", report)
+	}
+}
+
+func TestDiagnoseReportsDNSAndConnectFailures(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedURL := "http://" + listener.Addr().String()
+	listener.Close()
+
+	for _, test := range []struct {
+		url, stage string
+	}{
+		{"http://quicklog.host.invalid", "dns"},
+		{closedURL, "connect"},
+	} {
+		configureTest(t, nil, Config{ApiURL: test.url})
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		report := Diagnose(ctx)
+		cancel()
+		failed := report.Failed()
+		if failed == nil || failed.Name != test.stage || failed.Detail == "" {
+			t.Errorf("%s: got failed stage %+v, want %s\n%v", test.url, failed, test.stage, report)
+			continue
+		}
+		if last := report.Stages[len(report.Stages)-1]; last.Name != "post" || !last.Skipped {
+			t.Errorf("%s: got last stage %+v, want post skipped", test.url, last)
+		}
+	}
+}
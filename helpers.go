@@ -0,0 +1,227 @@
+package quicklog
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+/**
+ * Builds an identifier in the 'kind:id' form used for objects and targets.
+ * @param {string} kind e.g. 'user'
+ * @param {string} id e.g. '1234'
+ * @return string e.g. 'user:1234'
+ */
+func ID(kind, id string) string {
+	return kind + ":" + id
+}
+
+var tagKeyEscaper = strings.NewReplacer("%", "%25", ":", "%3A")
+
+/**
+ * Builds a tag the backend parses unambiguously. The backend splits a tag at
+ * its first colon, so:
+ *  - with a key, the result is 'key:value', and any '%' or ':' in the key is
+ *    percent-encoded ('%25', '%3A'); the value is kept as is, colons,
+ *    slashes and spaces included
+ *  - without a key, a value containing a colon is prefixed with ':' so it
+ *    isn't mistaken for 'key:value'
+ * @param {string} key (may be empty)
+ * @param {string} value
+ * @return string
+ */
+func Tag(key, value string) string {
+	if key == "" {
+		if strings.Contains(value, ":") {
+			return ":" + value
+		}
+		return value
+	}
+	return tagKeyEscaper.Replace(key) + ":" + value
+}
+
+// checkQualifiedID reports an error unless id is empty or of the form 'kind:id'.
+func checkQualifiedID(name, id string) error {
+	if id == "" {
+		return nil
+	}
+	i := strings.IndexByte(id, ':')
+	if i <= 0 || i == len(id)-1 {
+		return fmt.Errorf("'%s' must be of the form kind:id, got %q", name, id)
+	}
+	return nil
+}
+
+// TransitionAction is the action of entries created by LogTransition.
+const TransitionAction = "transition"
+
+/**
+ * Logs that a field of object changed from one value to another, as an entry
+ * with action "transition" and extra {"field", "from", "to"}.
+ * @param {Ctx} traceCtx
+ * @param {string} object identifier of the thing that changed
+ * @param {string} field name of the field that changed
+ * @param {interface{}} from previous value
+ * @param {interface{}} to new value (must differ from 'from')
+ * @param {tags}
+ * @return error
+ */
+func LogTransition(traceCtx Ctx, object, field string, from, to interface{}, tags ...string) error {
+	if field == "" {
+		return fmt.Errorf("'field' must be a non-empty string")
+	}
+	if reflect.DeepEqual(from, to) {
+		return fmt.Errorf("'from' and 'to' must differ for a transition of %q", field)
+	}
+	extra := map[string]interface{}{
+		"field": field,
+		"from":  from,
+		"to":    to,
+	}
+	return Log(Entry{Published: time.Now(), Action: TransitionAction, Object: object, Extra: extra, Ctx: traceCtx, Tags: tags})
+}
+
+/**
+ * Runs fn in a child span of traceCtx and then logs an entry for it with
+ * action, the time it started, and extra {"duration_ms"} plus {"error"} and
+ * the tag 'error' if fn failed. See StartSpan for more control.
+ * @param {Ctx} traceCtx parent of the span (a new trace if its TraceID is empty)
+ * @param {string} action
+ * @param {func} fn is passed the child Ctx
+ * @return error the error from fn, or else from logging the entry
+ */
+func Trace(traceCtx Ctx, action string, fn func(ctx Ctx) error) error {
+	span := StartSpan(traceCtx, action)
+	err := fn(span.Ctx)
+	logErr := span.End(err)
+	if err != nil {
+		return err
+	}
+	return logErr
+}
+
+/**
+ * Logs err with level 'error', adding {"error": err.Error()} to extra and the
+ * tags 'severity:error', 'error_type:<Go type of err>' and any from
+ * Config.ClassifyError. The first span of a trace (see Ctx.Child) to log an
+ * error is remembered, and later LogError and LogWarn entries in other spans
+ * of the trace get extra {"origin_span_id"} naming it.
+ * @param {Ctx} traceCtx
+ * @param {string} action
+ * @param {string} object
+ * @param {string} target
+ * @param {error} err
+ * @param {extra} (may be nil)
+ * @param {tags}
+ * @return error
+ */
+func LogError(traceCtx Ctx, action, object, target string, err error, extra map[string]interface{}, tags ...string) error {
+	return logError(LevelError, traceCtx, action, object, target, err, extra, tags)
+}
+
+/**
+ * Same as LogError but with level 'warn' and the tag 'severity:warn'.
+ * @return error
+ */
+func LogWarn(traceCtx Ctx, action, object, target string, err error, extra map[string]interface{}, tags ...string) error {
+	return logError(LevelWarn, traceCtx, action, object, target, err, extra, tags)
+}
+
+func logError(level Level, traceCtx Ctx, action, object, target string, err error, extra map[string]interface{}, tags []string) error {
+	if err == nil {
+		return fmt.Errorf("'err' must not be nil")
+	}
+	withError := make(map[string]interface{}, len(extra)+1)
+	for k, v := range extra {
+		withError[k] = v
+	}
+	withError["error"] = err.Error()
+	if state := stateOf(traceCtx.TraceID); state != nil {
+		if origin := state.origin(traceCtx.SpanID); origin != traceCtx.SpanID {
+			withError["origin_span_id"] = origin
+		}
+	}
+
+	allTags := append([]string{"severity:" + level.String(), Tag("error_type", fmt.Sprintf("%T", err))}, tags...)
+	if classify := loadSettings().ClassifyError; classify != nil {
+		allTags = append(allTags, classify(err)...)
+	}
+	return Log(Entry{Published: time.Now(), Level: level, Action: action, Object: object, Target: target, Extra: withError, Ctx: traceCtx, Tags: allTags})
+}
+
+// LagAction is the action of entries created by LogLag.
+const LagAction = "consumer.lag"
+
+/**
+ * Logs how far behind a consumer is, as an entry with action "consumer.lag"
+ * and extra {"lag_ms", "message_time"}. A messageTime in the future (from
+ * clock skew) is logged as a lag of 0 with {"message_in_future": true}.
+ * @param {Ctx} traceCtx
+ * @param {string} object e.g. the queue or message identifier
+ * @param {time.Time} messageTime when the message was produced
+ * @param {tags}
+ * @return error
+ */
+func LogLag(traceCtx Ctx, object string, messageTime time.Time, tags ...string) error {
+	now := time.Now()
+	lag := now.Sub(messageTime)
+	extra := map[string]interface{}{"message_time": messageTime}
+	if lag < 0 {
+		lag = 0
+		extra["message_in_future"] = true
+	}
+	extra["lag_ms"] = lag.Milliseconds()
+	return Log(Entry{Published: now, Action: LagAction, Object: object, Extra: extra, Ctx: traceCtx, Tags: tags})
+}
+
+// TracesError is returned by LogToTraces when the entry failed for some of
+// its traces. Errs maps each failed trace ID to its error.
+type TracesError struct {
+	Errs map[string]error
+}
+
+func (e *TracesError) Error() string {
+	traceIDs := make([]string, 0, len(e.Errs))
+	for traceID := range e.Errs {
+		traceIDs = append(traceIDs, traceID)
+	}
+	sort.Strings(traceIDs)
+	msgs := make([]string, len(traceIDs))
+	for i, traceID := range traceIDs {
+		msgs[i] = traceID + ": " + e.Errs[traceID].Error()
+	}
+	return fmt.Sprintf("entry failed for %d of its traces: %s", len(e.Errs), strings.Join(msgs, "; "))
+}
+
+/**
+ * Logs e, e.g. a deployment or config change, once in each of the traces,
+ * as a new span with no known parent (see TraceCtxFromTrace) and the
+ * ActorID of e.Ctx. Repeated trace IDs are logged once. If it fails for any
+ * trace a *TracesError is returned after all the traces have been tried.
+ * @param {context.Context} ctx
+ * @param {Entry} e
+ * @param {string} traceIDs
+ * @return error
+ */
+func LogToTraces(ctx context.Context, e Entry, traceIDs ...string) error {
+	errs := make(map[string]error)
+	seen := make(map[string]bool, len(traceIDs))
+	for _, traceID := range traceIDs {
+		if traceID == "" || seen[traceID] {
+			continue
+		}
+		seen[traceID] = true
+		traceEntry := e
+		traceEntry.Ctx = TraceCtxFromTrace(e.Ctx.ActorID, traceID)
+		if err := LogContext(ctx, traceEntry); err != nil {
+			errs[traceID] = err
+		}
+	}
+	if len(errs) > 0 {
+		return &TracesError{Errs: errs}
+	}
+	return nil
+}
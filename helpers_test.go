@@ -0,0 +1,211 @@
+package quicklog
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogTransition(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{})
+	traceCtx := TraceCtx("", "", "")
+	if err := LogTransition(traceCtx, "order:1", "status", "paid", "shipped", "t"); err != nil {
+		t.Fatal(err)
+	}
+	e := s.Entries()[0]
+	context := e["context"].(map[string]interface{})
+	if e["type"] != TransitionAction || e["object"] != "order:1" || context["field"] != "status" || context["from"] != "paid" || context["to"] != "shipped" {
+		t.Errorf("got %v", e)
+	}
+	if len(s.Tags()) != 1 {
+		t.Errorf("got %d tags, want 1", len(s.Tags()))
+	}
+
+	if err := LogTransition(traceCtx, "order:1", "status", "paid", "paid"); err == nil {
+		t.Error("a transition to the same value was logged")
+	}
+	if err := LogTransition(traceCtx, "order:1", "", 1, 2); err == nil {
+		t.Error("a transition without a field was logged")
+	}
+	if len(s.Entries()) != 1 {
+		t.Errorf("got %d entries, want 1", len(s.Entries()))
+	}
+}
+
+func TestRequireQualifiedIDs(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{RequireQualifiedIDs: true})
+	traceCtx := TraceCtx("", "", "")
+	if err := Log(Entry{Action: "a", Object: ID("user", "1"), Target: "", Ctx: traceCtx}); err != nil {
+		t.Errorf("qualified IDs rejected: %v", err)
+	}
+	for _, id := range []string{"user", ":1", "user:"} {
+		if err := Log(Entry{Action: "a", Target: id, Ctx: traceCtx}); err == nil {
+			t.Errorf("target %q accepted", id)
+		}
+	}
+	if len(s.Entries()) != 1 {
+		t.Errorf("got %d entries, want 1", len(s.Entries()))
+	}
+}
+
+func TestTrace(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{})
+	parent := TraceCtx("", "", "")
+	var child Ctx
+	if err := Trace(parent, "work", func(ctx Ctx) error { child = ctx; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	failure := errors.New("failed")
+	if err := Trace(parent, "work", func(ctx Ctx) error { return failure }); err != failure {
+		t.Errorf("got %v, want fn's error", err)
+	}
+
+	if child.TraceID != parent.TraceID || child.ParentSpanID != parent.SpanID {
+		t.Errorf("fn got %+v, not a child of %+v", child, parent)
+	}
+	entries := s.Entries()
+	if len(entries) != 2 || entries[0]["span_id"] != child.SpanID {
+		t.Fatalf("got entries %v", entries)
+	}
+	ok, failed := entries[0]["context"].(map[string]interface{}), entries[1]["context"].(map[string]interface{})
+	if _, has := ok["duration_ms"]; !has || ok["error"] != nil {
+		t.Errorf("got context %v for a success", ok)
+	}
+	if failed["error"] != "failed" {
+		t.Errorf("got context %v for a failure", failed)
+	}
+	if tags := s.Tags(); len(tags) != 1 || tags[0]["tag"] != "error" {
+		t.Errorf("got tags %v, want one error tag", tags)
+	}
+}
+
+func TestTag(t *testing.T) {
+	for _, test := range [][3]string{
+		{"key", "value", "key:value"},
+		{"key", "a:b/c d", "key:a:b/c d"},
+		{"k:e%y", "v", "k%3Ae%25y:v"},
+		{"", "value", "value"},
+		{"", "a:b", ":a:b"},
+	} {
+		if got := Tag(test[0], test[1]); got != test[2] {
+			t.Errorf("Tag(%q, %q) = %q, want %q", test[0], test[1], got, test[2])
+		}
+	}
+}
+
+func TestLogError(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{ClassifyError: func(err error) []string { return []string{"error_class:timeout"} }})
+	traceCtx := TraceCtx("", "", "")
+	if err := LogError(traceCtx, "a", "", "", errors.New("timed out"), map[string]interface{}{"k": "v"}, "own"); err != nil {
+		t.Fatal(err)
+	}
+	if err := LogWarn(traceCtx, "b", "", "", errors.New("slow"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := LogError(traceCtx, "c", "", "", nil, nil); err == nil {
+		t.Error("a nil error was logged")
+	}
+
+	entries := s.Entries()
+	context := entries[0]["context"].(map[string]interface{})
+	if entries[0]["level"] != "error" || entries[1]["level"] != "warn" || context["error"] != "timed out" || context["k"] != "v" {
+		t.Errorf("got entries %v", entries)
+	}
+	var tags []string
+	for _, tag := range s.Tags() {
+		tags = append(tags, tag["tag"].(string))
+	}
+	want := []string{"severity:error", "error_type:*errors.errorString", "own", "error_class:timeout", "severity:warn", "error_type:*errors.errorString", "error_class:timeout"}
+	if len(tags) != len(want) {
+		t.Fatalf("got tags %v, want %v", tags, want)
+	}
+	for i := range want {
+		if tags[i] != want[i] {
+			t.Errorf("got tags %v, want %v", tags, want)
+			break
+		}
+	}
+}
+
+func TestLogErrorRecordsOriginSpan(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{})
+	root := TraceCtx("", "", "")
+	origin, caller := root.Child(), root.Child()
+	for _, c := range []Ctx{origin, caller, origin} {
+		if err := LogError(c, "a", "", "", errors.New("failed"), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries := s.Entries()
+	var got []interface{}
+	for _, e := range entries {
+		got = append(got, e["context"].(map[string]interface{})["origin_span_id"])
+	}
+	if got[0] != nil || got[1] != origin.SpanID || got[2] != nil {
+		t.Errorf("got origin_span_id %v, want only the second naming %s", got, origin.SpanID)
+	}
+}
+
+func TestLogLag(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{})
+	traceCtx := TraceCtx("", "", "")
+	if err := LogLag(traceCtx, "queue:orders", time.Now().Add(-2*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := LogLag(traceCtx, "queue:orders", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	entries := s.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	behind := entries[0]["context"].(map[string]interface{})
+	if entries[0]["type"] != LagAction || behind["lag_ms"].(float64) < 2000 || behind["message_in_future"] != nil {
+		t.Errorf("got %v for a message 2s old", entries[0])
+	}
+	ahead := entries[1]["context"].(map[string]interface{})
+	if ahead["lag_ms"] != float64(0) || ahead["message_in_future"] != true {
+		t.Errorf("got context %v for a message in the future", ahead)
+	}
+}
+
+func TestLogToTraces(t *testing.T) {
+	s := newTestServer(t)
+	s.Handler = func(w http.ResponseWriter, r *http.Request, body []byte) {
+		if strings.Contains(string(body), "bbbbbbbbbbbbbbbb") {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}
+	configureTest(t, s, Config{})
+	e := Entry{Action: "deploy", Object: "service:api", Ctx: TraceCtx("user:1", "", "")}
+	err := LogToTraces(context.Background(), e, "aaaaaaaaaaaaaaaa", "bbbbbbbbbbbbbbbb", "aaaaaaaaaaaaaaaa", "", "cccccccccccccccc")
+	tracesErr, ok := err.(*TracesError)
+	if !ok || len(tracesErr.Errs) != 1 || tracesErr.Errs["bbbbbbbbbbbbbbbb"] == nil {
+		t.Fatalf("got %v, want a TracesError for the failed trace", err)
+	}
+	if !strings.Contains(err.Error(), "1 of its traces") || !strings.Contains(err.Error(), "bbbbbbbbbbbbbbbb: ") {
+		t.Errorf("got message %q", err.Error())
+	}
+
+	entries := s.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want one per distinct trace", len(entries))
+	}
+	for i, traceID := range []string{"aaaaaaaaaaaaaaaa", "bbbbbbbbbbbbbbbb", "cccccccccccccccc"} {
+		if entries[i]["trace_id"] != traceID || entries[i]["actor"] != "user:1" || entries[i]["type"] != "deploy" || entries[i]["parent_span_id"] != "" {
+			t.Errorf("got %v for trace %s", entries[i], traceID)
+		}
+	}
+	if err := LogToTraces(context.Background(), e, "aaaaaaaaaaaaaaaa"); err != nil {
+		t.Errorf("got %v, want nil when every trace succeeds", err)
+	}
+}
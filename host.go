@@ -0,0 +1,23 @@
+package quicklog
+
+import "os"
+
+const hostKey = "_host"
+
+// lookupHostMetadata is called once by Configure so entries don't pay for the lookups.
+func lookupHostMetadata(envNames []string) map[string]interface{} {
+	meta := map[string]interface{}{"pid": os.Getpid()}
+	if hostname, err := os.Hostname(); err == nil {
+		meta["hostname"] = hostname
+	}
+	if len(envNames) != 0 {
+		env := make(map[string]string, len(envNames))
+		for _, name := range envNames {
+			if value, ok := os.LookupEnv(name); ok {
+				env[name] = value
+			}
+		}
+		meta["env"] = env
+	}
+	return meta
+}
@@ -0,0 +1,32 @@
+package quicklog
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestHostMetadata(t *testing.T) {
+	t.Setenv("QUICKLOG_TEST_REGION", "test-1")
+	s := newTestServer(t)
+	configureTest(t, s, Config{HostMetadata: true, HostEnv: []string{"QUICKLOG_TEST_REGION", "QUICKLOG_TEST_UNSET"}})
+	extra := map[string]interface{}{"key": "value"}
+	if err := Quicklog(time.Now(), "a", "", "", extra, TraceCtx("", "", "")); err != nil {
+		t.Fatal(err)
+	}
+	if len(extra) != 1 {
+		t.Errorf("the caller's extra was modified: %v", extra)
+	}
+	context := s.Entries()[0]["context"].(map[string]interface{})
+	host, ok := context[hostKey].(map[string]interface{})
+	if !ok || context["key"] != "value" {
+		t.Fatalf("got context %v", context)
+	}
+	if host["pid"] != float64(os.Getpid()) {
+		t.Errorf("got pid %v", host["pid"])
+	}
+	env := host["env"].(map[string]interface{})
+	if len(env) != 1 || env["QUICKLOG_TEST_REGION"] != "test-1" {
+		t.Errorf("got env %v", env)
+	}
+}
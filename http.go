@@ -0,0 +1,171 @@
+package quicklog
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * Creates a child Ctx continuing the trace of an inbound request. Each
+ * Config.Propagation format is tried in turn, by default the W3C 'traceparent'
+ * header, then B3 ('b3' or 'X-B3-TraceId'/'X-B3-SpanId'). If none matches a
+ * new root Ctx is returned.
+ * @param {*http.Request} r
+ * @param {func} actorFunc returns the ActorID for the request (may be nil)
+ * @return Ctx
+ */
+func CtxFromRequest(r *http.Request, actorFunc func(*http.Request) string) Ctx {
+	actorID := ""
+	if actorFunc != nil {
+		actorID = actorFunc(r)
+	}
+	for _, f := range propagation() {
+		if traceID, spanID, ok := f.Extract(r.Header); ok {
+			return TraceCtx(actorID, traceID, spanID)
+		}
+	}
+	return TraceCtx(actorID, "", "")
+}
+
+/**
+ * Returns an actorFunc for CtxFromRequest that uses a claim of the request's
+ * bearer JWT as the ActorID, e.g. JWTActor("sub"). The token's signature is
+ * NOT verified, so only use this after something else has verified it. A
+ * missing or malformed token, or a missing claim, gives an empty actor.
+ * @param {string} claim the claim name; "sub" if empty
+ * @return func(*http.Request) string
+ */
+func JWTActor(claim string) func(*http.Request) string {
+	if claim == "" {
+		claim = "sub"
+	}
+	return func(r *http.Request) string {
+		auth := r.Header.Get("Authorization")
+		if len(auth) < 7 || !strings.EqualFold(auth[:7], "bearer ") {
+			return ""
+		}
+		parts := strings.Split(strings.TrimSpace(auth[7:]), ".")
+		if len(parts) != 3 {
+			return ""
+		}
+		payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+		if err != nil {
+			return ""
+		}
+		var claims map[string]interface{}
+		if err := json.Unmarshal(payload, &claims); err != nil {
+			return ""
+		}
+		switch v := claims[claim].(type) {
+		case string:
+			return v
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		return ""
+	}
+}
+
+type ctxKey struct{}
+
+/**
+ * Returns a copy of ctx carrying traceCtx, e.g. for Transport to read.
+ * @param {context.Context} ctx
+ * @param {Ctx} traceCtx
+ * @return context.Context
+ */
+func NewContext(ctx context.Context, traceCtx Ctx) context.Context {
+	return context.WithValue(ctx, ctxKey{}, traceCtx)
+}
+
+/**
+ * Returns the Ctx stored in ctx by NewContext, if any.
+ * @param {context.Context} ctx
+ * @return Ctx, bool
+ */
+func FromContext(ctx context.Context) (Ctx, bool) {
+	traceCtx, ok := ctx.Value(ctxKey{}).(Ctx)
+	return traceCtx, ok
+}
+
+// HTTPClientAction is the default action of entries logged by Transport.
+const HTTPClientAction = "http.client"
+
+// Transport is an http.RoundTripper that makes each request in a child span
+// of the Ctx in the request's context (see NewContext), or in a new trace,
+// sends the Config.Propagation trace headers, and logs an entry for the request with
+// LogDetached. The entry's extra has method, host, path, query, status (or
+// error) and duration_ms. Don't use it in Config.Client, or each entry sent
+// would log another.
+type Transport struct {
+	// Base makes the requests; http.DefaultTransport if nil.
+	Base http.RoundTripper
+	// Action defaults to HTTPClientAction.
+	Action string
+	// PathTemplate, when set, returns the path to log for a request, e.g.
+	// "/users/{id}" rather than "/users/1234".
+	PathTemplate func(req *http.Request) string
+	// RedactQuery lists query parameters whose values are logged as "REDACTED".
+	RedactQuery []string
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	parent, ok := FromContext(req.Context())
+	var traceCtx Ctx
+	if ok {
+		traceCtx = parent.Child()
+	} else {
+		traceCtx = TraceCtx("", "", "")
+	}
+	out := req.Clone(req.Context())
+	injectHeaders(out.Header, traceCtx)
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	start := time.Now()
+	resp, err := base.RoundTrip(out)
+
+	path := req.URL.Path
+	if t.PathTemplate != nil {
+		path = t.PathTemplate(req)
+	}
+	extra := map[string]interface{}{
+		"method":      req.Method,
+		"host":        req.URL.Host,
+		"path":        path,
+		"duration_ms": durationMillis(start),
+	}
+	if query := t.redactedQuery(req.URL.Query()); query != "" {
+		extra["query"] = query
+	}
+	var tags []string
+	if err != nil {
+		extra["error"] = err.Error()
+		tags = append(tags, "error")
+	} else {
+		extra["status"] = resp.StatusCode
+	}
+	action := t.Action
+	if action == "" {
+		action = HTTPClientAction
+	}
+	logDetached(Entry{Published: start, Action: action, Object: req.URL.Host, Extra: extra, Ctx: traceCtx, Tags: tags})
+	return resp, err
+}
+
+func (t *Transport) redactedQuery(query url.Values) string {
+	for _, name := range t.RedactQuery {
+		if _, ok := query[name]; ok {
+			query[name] = []string{"REDACTED"}
+		}
+	}
+	return query.Encode()
+}
@@ -0,0 +1,122 @@
+package quicklog
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCtxFromRequest(t *testing.T) {
+	configureTest(t, nil, Config{})
+	actor := func(r *http.Request) string { return r.Header.Get("X-User") }
+	for _, test := range []struct {
+		name    string
+		headers map[string]string
+		traceID string
+	}{
+		{"w3c", map[string]string{"traceparent": "00-00000000000000000123456789abcdef-1111111111111111-01"}, "0123456789abcdef"},
+		{"w3c 32 digits", map[string]string{"traceparent": "00-fedcba98765432100123456789abcdef-1111111111111111-01"}, "fedcba98765432100123456789abcdef"},
+		{"b3", map[string]string{"X-B3-TraceId": "0123456789abcdef", "X-B3-SpanId": "1111111111111111"}, "0123456789abcdef"},
+		{"b3 single", map[string]string{"b3": "0123456789abcdef-1111111111111111-1"}, "0123456789abcdef"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-User", "user:1")
+		for k, v := range test.headers {
+			r.Header.Set(k, v)
+		}
+		c := CtxFromRequest(r, actor)
+		if c.TraceID != test.traceID || c.ParentSpanID != "1111111111111111" || c.ActorID != "user:1" {
+			t.Errorf("%s: got %+v", test.name, c)
+		}
+		if c.SpanID == "" || c.SpanID == c.ParentSpanID {
+			t.Errorf("%s: got span %q", test.name, c.SpanID)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("traceparent", "garbage")
+	c := CtxFromRequest(r, nil)
+	if c.TraceID != c.SpanID || c.ParentSpanID != "" {
+		t.Errorf("a malformed header gave %+v, want a new root", c)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Clone()
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer app.Close()
+	sink := &recordingSink{}
+	configureTest(t, nil, Config{Sink: sink})
+
+	parent := TraceCtx("", "", "")
+	client := &http.Client{Transport: &Transport{
+		RedactQuery:  []string{"token"},
+		PathTemplate: func(req *http.Request) string { return "/users/{id}" },
+	}}
+	req, _ := http.NewRequestWithContext(NewContext(context.Background(), parent), http.MethodGet, app.URL+"/users/1?token=secret&page=2", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	got := <-headers
+	traceID, parentSpanID, ok := W3CFormat.Extract(got)
+	if !ok || traceID != parent.TraceID || parentSpanID == parent.SpanID {
+		t.Errorf("got traceparent %q, want a child span of %+v", got.Get("traceparent"), parent)
+	}
+	if got.Get("X-B3-TraceId") != parent.TraceID {
+		t.Errorf("got B3 headers %v", got)
+	}
+	entries := sink.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	var e entryBody
+	json.Unmarshal(entries[0], &e)
+	extra := e.Context.(map[string]interface{})
+	if e.Type != HTTPClientAction || e.SpanID != parentSpanID || e.ParentSpanID != parent.SpanID {
+		t.Errorf("got entry %+v", e)
+	}
+	if extra["path"] != "/users/{id}" || extra["status"] != float64(http.StatusTeapot) || extra["query"] != "page=2&token=REDACTED" || extra["method"] != "GET" {
+		t.Errorf("got extra %v", extra)
+	}
+}
+
+func TestJWTActor(t *testing.T) {
+	token := func(claims string) string {
+		return "Bearer e30." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".sig"
+	}
+	for _, test := range []struct {
+		claim, auth, want string
+	}{
+		{"", token(`{"sub":"user:1"}`), "user:1"},
+		{"uid", token(`{"sub":"user:1","uid":1234}`), "1234"},
+		{"", "bearer " + token(`{"sub":"user:1"}`)[7:], "user:1"},
+		{"", token(`{"uid":1234}`), ""},
+		{"", token(`not json`), ""},
+		{"", "Basic dXNlcjpwYXNz", ""},
+		{"", "Bearer only.two", ""},
+		{"", "", ""},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if test.auth != "" {
+			r.Header.Set("Authorization", test.auth)
+		}
+		if got := JWTActor(test.claim)(r); got != test.want {
+			t.Errorf("claim %q of %q: got %q, want %q", test.claim, test.auth, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package quicklog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Level is the severity of an entry. The zero value means no level is sent.
+type Level int
+
+const (
+	LevelDebug Level = iota + 1
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
+// MarshalText encodes the zero Level as "" (no level).
+func (l Level) MarshalText() ([]byte, error) {
+	if l == 0 {
+		return []byte{}, nil
+	}
+	name, ok := levelNames[l]
+	if !ok {
+		return nil, fmt.Errorf("invalid level %d", int(l))
+	}
+	return []byte(name), nil
+}
+
+// UnmarshalText decodes level names case-insensitively, and "warning" as
+// LevelWarn. Empty and unknown names, as other clients may send, decode as
+// the zero Level rather than failing the whole entry.
+func (l *Level) UnmarshalText(text []byte) error {
+	name := strings.ToLower(string(text))
+	if name == "warning" {
+		name = "warn"
+	}
+	*l = 0
+	for level, levelName := range levelNames {
+		if levelName == name {
+			*l = level
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package quicklog
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLevelText(t *testing.T) {
+	for level, name := range levelNames {
+		text, err := level.MarshalText()
+		if err != nil || string(text) != name {
+			t.Errorf("%d marshaled as %q, %v", int(level), text, err)
+		}
+	}
+	if text, err := Level(0).MarshalText(); err != nil || len(text) != 0 {
+		t.Errorf("zero level marshaled as %q, %v", text, err)
+	}
+	var fields struct {
+		Level    Level `json:"level"`
+		MinLevel Level `json:"min_level"`
+	}
+	if data, err := json.Marshal(fields); err != nil || string(data) != `{"level":"","min_level":""}` {
+		t.Errorf("zero levels marshaled as %s, %v", data, err)
+	}
+
+	for text, want := range map[string]Level{"warn": LevelWarn, "WARNING": LevelWarn, "Error": LevelError, "": 0, "fatal": 0} {
+		var got Level
+		if err := got.UnmarshalText([]byte(text)); err != nil || got != want {
+			t.Errorf("%q decoded as %v, %v; want %v", text, got, err, want)
+		}
+	}
+}
+
+func TestMinLevel(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{MinLevel: LevelWarn})
+	traceCtx := TraceCtx("", "", "")
+	now := time.Now()
+	Debug(now, "debug", "", "", nil, traceCtx)
+	Info(now, "info", "", "", nil, traceCtx)
+	Warn(now, "warn", "", "", nil, traceCtx)
+	Error(now, "error", "", "", nil, traceCtx)
+	Quicklog(now, "no-level", "", "", nil, traceCtx)
+
+	var got []string
+	for _, e := range s.Entries() {
+		got = append(got, e["type"].(string)+":"+stringField(e, "level"))
+	}
+	want := []string{"warn:warn", "error:error", "no-level:"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func stringField(e map[string]interface{}, key string) string {
+	s, _ := e[key].(string)
+	return s
+}
+
+func TestGetTraceToleratesUnknownLevels(t *testing.T) {
+	s := newTestServer(t)
+	s.Handler = func(w http.ResponseWriter, r *http.Request, body []byte) {
+		w.Write([]byte(`[{"type":"a","level":""},{"type":"b","level":"warning"},{"type":"c","level":"critical"}]`))
+	}
+	configureTest(t, s, Config{})
+	entries, err := GetTrace(context.Background(), "trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Level{0, LevelWarn, 0}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(want))
+	}
+	for i, e := range entries {
+		if e.Level != want[i] {
+			t.Errorf("entry %q has level %v, want %v", e.Action, e.Level, want[i])
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package quicklog
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Actions of the entries logged when Config.EmitLifecycleEvents is set.
+const (
+	StartupAction  = "quicklog.startup"
+	ShutdownAction = "quicklog.shutdown"
+)
+
+var (
+	lifecycleMu sync.Mutex
+	// lifecycleCtx is the trace of this instance's lifecycle entries, if started.
+	lifecycleCtx *Ctx
+)
+
+// emitStartup logs the startup entry, in the background, the first time
+// Configure is called with EmitLifecycleEvents.
+func emitStartup(cfg *settings) {
+	lifecycleMu.Lock()
+	defer lifecycleMu.Unlock()
+	if lifecycleCtx != nil {
+		return
+	}
+	traceCtx := TraceCtx("", "", "")
+	lifecycleCtx = &traceCtx
+	extra := map[string]interface{}{
+		"version":    Version,
+		"go_version": runtime.Version(),
+		"pid":        os.Getpid(),
+		"config": map[string]interface{}{
+			"project_id":  cfg.ProjectID,
+			"source":      cfg.Source,
+			"api_url":     cfg.ApiURL,
+			"custom_sink": cfg.Sink != nil,
+			"max_retries": cfg.MaxRetries,
+		},
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		extra["hostname"] = hostname
+	}
+	logDetachedWith(cfg, Entry{Published: time.Now(), Action: StartupAction, Object: cfg.Source, Extra: extra, Ctx: traceCtx.Child()})
+}
+
+/**
+ * Waits for pending LogDetached entries to be sent, including those logged
+ * before the last Configure, then, if
+ * Config.EmitLifecycleEvents started a lifecycle trace, logs its shutdown
+ * entry and waits for it to be sent. Call it before the process exits.
+ * @param {context.Context} ctx bounds the wait and the shutdown entry
+ * @return error from the shutdown entry, or ctx's error if it ended first
+ */
+func Close(ctx context.Context) error {
+	sent := make(chan struct{})
+	go func() {
+		detachedPending.Wait()
+		close(sent)
+	}()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-sent:
+	}
+
+	lifecycleMu.Lock()
+	traceCtx := lifecycleCtx
+	lifecycleCtx = nil
+	lifecycleMu.Unlock()
+	if traceCtx == nil {
+		return nil
+	}
+	return LogContext(ctx, Entry{Published: time.Now(), Action: ShutdownAction, Object: loadSettings().Source, Ctx: traceCtx.Child()})
+}
@@ -0,0 +1,34 @@
+package quicklog
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLifecycleEvents(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{Source: "svc", EmitLifecycleEvents: true})
+	configureTest(t, s, Config{Source: "svc", EmitLifecycleEvents: true})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := s.Entries()
+	if len(entries) != 2 || entries[0]["type"] != StartupAction || entries[1]["type"] != ShutdownAction {
+		t.Fatalf("got %v, want one startup and one shutdown entry", entries)
+	}
+	if entries[0]["trace_id"] != entries[1]["trace_id"] || entries[0]["object"] != "svc" {
+		t.Errorf("got %v, want both in one trace for the source", entries)
+	}
+	extra := entries[0]["context"].(map[string]interface{})
+	config := extra["config"].(map[string]interface{})
+	if extra["version"] != Version || config["source"] != "svc" || config["custom_sink"] != false {
+		t.Errorf("got startup context %v", extra)
+	}
+}
@@ -0,0 +1,268 @@
+package quicklog
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// truncatedKey is added to an extra that was cut down by MaxExtraDepth or MaxExtraKeys.
+const truncatedKey = "_truncated"
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// extraLimiter walks an extra applying Config.MaxExtraDepth and MaxExtraKeys.
+type extraLimiter struct {
+	maxDepth  int
+	keysLeft  int
+	truncated bool
+	path      map[pathKey]bool // pointers, maps and slices being walked, to stop at cycles
+}
+
+// pathKey identifies a value being walked; the type tells apart e.g. a
+// pointer to an array and a slice of it, which share an address.
+type pathKey struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+// limitExtra returns extra cut down to the configured limits, with
+// {"_truncated": true}, or an error if RejectLargeExtra is set.
+func limitExtra(cfg *settings, extra map[string]interface{}) (map[string]interface{}, error) {
+	if (cfg.MaxExtraDepth <= 0 && cfg.MaxExtraKeys <= 0) || extra == nil {
+		return extra, nil
+	}
+	l := &extraLimiter{maxDepth: cfg.MaxExtraDepth, keysLeft: cfg.MaxExtraKeys, path: make(map[pathKey]bool)}
+	if l.keysLeft <= 0 {
+		l.keysLeft = -1
+	}
+	limited := l.limit(reflect.ValueOf(extra), 1).(map[string]interface{})
+	if !l.truncated {
+		return extra, nil
+	}
+	if cfg.RejectLargeExtra {
+		return nil, fmt.Errorf("'extra' exceeds MaxExtraDepth %d or MaxExtraKeys %d", cfg.MaxExtraDepth, cfg.MaxExtraKeys)
+	}
+	limited[truncatedKey] = true
+	return limited, nil
+}
+
+// limit returns a copy of v within the limits, with its maps and structs as
+// map[string]interface{} and its slices and arrays as []interface{}; depth
+// is the nesting level of v, 1 for the extra itself. Pointers and interfaces
+// are followed without adding a level. Values that marshal themselves (e.g.
+// time.Time) and byte slices are kept whole.
+func (l *extraLimiter) limit(v reflect.Value, depth int) interface{} {
+	if !v.IsValid() || !v.CanInterface() {
+		return nil
+	}
+	t := v.Type()
+	if t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) {
+		return v.Interface()
+	}
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return l.limit(v.Elem(), depth)
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		if !l.enter(v, depth, false) {
+			return nil
+		}
+		defer l.leave(v)
+		return l.limit(v.Elem(), depth)
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		if !l.enter(v, depth, true) {
+			return nil
+		}
+		defer l.leave(v)
+		keys := make([]string, 0, v.Len())
+		values := make(map[string]reflect.Value, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			k := mapKey(iter.Key())
+			keys = append(keys, k)
+			values[k] = iter.Value()
+		}
+		sort.Strings(keys)
+		result := make(map[string]interface{}, len(keys))
+		for _, k := range keys {
+			if !l.take() {
+				break
+			}
+			result[k] = l.limit(values[k], depth+1)
+		}
+		return result
+	case reflect.Struct:
+		if l.maxDepth > 0 && depth > l.maxDepth {
+			l.truncated = true
+			return nil
+		}
+		result := make(map[string]interface{})
+		l.fields(v, depth, result)
+		return result
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+		if v.IsNil() {
+			return nil
+		}
+		if v.Len() == 0 {
+			return []interface{}{}
+		}
+		if !l.enter(v, depth, true) {
+			return nil
+		}
+		defer l.leave(v)
+		return l.items(v, depth)
+	case reflect.Array:
+		if v.Len() == 0 {
+			return []interface{}{}
+		}
+		if l.maxDepth > 0 && depth > l.maxDepth {
+			l.truncated = true
+			return nil
+		}
+		return l.items(v, depth)
+	}
+	return v.Interface()
+}
+
+// enter records that v is being walked, reporting false (and marking the
+// extra truncated) at a cycle or, for a map or slice, beyond MaxExtraDepth.
+func (l *extraLimiter) enter(v reflect.Value, depth int, nests bool) bool {
+	key := pathKey{v.Pointer(), v.Type()}
+	if l.path[key] || (nests && l.maxDepth > 0 && depth > l.maxDepth) {
+		l.truncated = true
+		return false
+	}
+	l.path[key] = true
+	return true
+}
+
+func (l *extraLimiter) leave(v reflect.Value) {
+	delete(l.path, pathKey{v.Pointer(), v.Type()})
+}
+
+func (l *extraLimiter) items(v reflect.Value, depth int) []interface{} {
+	result := make([]interface{}, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		if !l.take() {
+			break
+		}
+		result = append(result, l.limit(v.Index(i), depth+1))
+	}
+	return result
+}
+
+// fields adds the fields of struct v to result by their JSON names, as
+// encoding/json would marshal them; embedded structs without a name are
+// flattened into it.
+func (l *extraLimiter) fields(v reflect.Value, depth int, result map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts := f.Name, ""
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			if tag == "-" {
+				continue
+			}
+			if comma := strings.IndexByte(tag, ','); comma >= 0 {
+				tag, opts = tag[:comma], tag[comma:]
+			}
+			if tag != "" {
+				name = tag
+			} else if f.Anonymous {
+				name = ""
+			}
+		} else if f.Anonymous {
+			name = ""
+		}
+		fv := v.Field(i)
+		if name == "" {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				l.fields(fv, depth, result)
+				continue
+			}
+			name = f.Name
+		}
+		if f.PkgPath != "" || (strings.Contains(opts, ",omitempty") && isEmptyValue(fv)) {
+			continue
+		}
+		if !l.take() {
+			return
+		}
+		result[name] = l.limit(fv, depth+1)
+	}
+}
+
+// mapKey formats a map key as encoding/json does.
+func mapKey(k reflect.Value) string {
+	if k.Kind() == reflect.String {
+		return k.String()
+	}
+	if m, ok := k.Interface().(encoding.TextMarshaler); ok {
+		if text, err := m.MarshalText(); err == nil {
+			return string(text)
+		}
+	}
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10)
+	}
+	return fmt.Sprint(k.Interface())
+}
+
+// isEmptyValue reports whether v is empty in the sense of 'omitempty'.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// take uses up one of MaxExtraKeys, reporting false once none are left.
+func (l *extraLimiter) take() bool {
+	if l.keysLeft < 0 {
+		return true
+	}
+	if l.keysLeft == 0 {
+		l.truncated = true
+		return false
+	}
+	l.keysLeft--
+	return true
+}
@@ -0,0 +1,96 @@
+package quicklog
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLimitExtra(t *testing.T) {
+	cyclic := map[string]interface{}{"x": 1}
+	cyclic["self"] = cyclic
+	for _, test := range []struct {
+		name  string
+		cfg   Config
+		extra map[string]interface{}
+		want  map[string]interface{}
+	}{
+		{"within limits", Config{MaxExtraDepth: 2, MaxExtraKeys: 3},
+			map[string]interface{}{"a": 1, "b": map[string]interface{}{"c": 2}},
+			map[string]interface{}{"a": 1, "b": map[string]interface{}{"c": 2}}},
+		{"too deep", Config{MaxExtraDepth: 2},
+			map[string]interface{}{"a": 1, "b": map[string]interface{}{"c": map[string]interface{}{"d": 1}, "e": []interface{}{1}}},
+			map[string]interface{}{"a": 1, "b": map[string]interface{}{"c": nil, "e": nil}, truncatedKey: true}},
+		{"too many keys", Config{MaxExtraKeys: 4},
+			map[string]interface{}{"a": 1, "b": []interface{}{1, 2, 3}, "c": 3},
+			map[string]interface{}{"a": 1, "b": []interface{}{1, 2}, truncatedKey: true}},
+		{"cycle", Config{MaxExtraKeys: 100},
+			cyclic,
+			map[string]interface{}{"x": 1, "self": nil, truncatedKey: true}},
+	} {
+		got, err := limitExtra(&settings{Config: test.cfg}, test.extra)
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, %v, want %v", test.name, got, err, test.want)
+		}
+		test.cfg.RejectLargeExtra = true
+		_, err = limitExtra(&settings{Config: test.cfg}, test.extra)
+		if truncated := test.want[truncatedKey] != nil; (err != nil) != truncated {
+			t.Errorf("%s: got %v with RejectLargeExtra", test.name, err)
+		}
+	}
+}
+
+// node is a domain object graph, as might be passed as extra by mistake.
+type node struct {
+	Name     string            `json:"name"`
+	Attrs    map[string]string `json:"attrs,omitempty"`
+	Children []*node           `json:"children"`
+	Parent   *node             `json:"-"`
+	Next     *node             `json:"next,omitempty"`
+	secret   string
+}
+
+func TestLimitExtraWalksTypedValues(t *testing.T) {
+	cfg := &settings{Config: Config{MaxExtraKeys: 2}}
+	got, err := limitExtra(cfg, map[string]interface{}{"a": map[string]string{"x": "1", "y": "2", "z": "3"}})
+	want := map[string]interface{}{"a": map[string]interface{}{"x": "1"}, truncatedKey: true}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("typed map: got %v, %v, want %v", got, err, want)
+	}
+
+	root := &node{Name: "root", secret: "s"}
+	child := &node{Name: "child", Attrs: map[string]string{"k": "v"}, Parent: root}
+	root.Children = []*node{child, {Name: "other"}}
+	child.Next = root
+	cfg = &settings{Config: Config{MaxExtraDepth: 5}}
+	got, err = limitExtra(cfg, map[string]interface{}{"root": root})
+	want = map[string]interface{}{
+		"root": map[string]interface{}{
+			"name": "root",
+			"children": []interface{}{
+				map[string]interface{}{"name": "child", "attrs": map[string]interface{}{"k": "v"}, "children": nil, "next": nil},
+				map[string]interface{}{"name": "other", "children": nil},
+			},
+		},
+		truncatedKey: true,
+	}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("struct graph: got %v, %v, want %v", got, err, want)
+	}
+
+	cfg = &settings{Config: Config{MaxExtraDepth: 2}}
+	deep := map[string]interface{}{"root": root}
+	if got, _ := limitExtra(cfg, deep); !reflect.DeepEqual(got["root"], map[string]interface{}{"name": "root", "children": nil}) {
+		t.Errorf("got %v, want the children beyond depth 2 dropped", got)
+	}
+}
+
+func TestRejectLargeExtra(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{MaxExtraKeys: 1, RejectLargeExtra: true})
+	if err := Log(Entry{Action: "a", Extra: map[string]interface{}{"a": 1, "b": 2}, Ctx: TraceCtx("", "", "")}); err == nil {
+		t.Error("a large extra was accepted")
+	}
+	if len(s.Entries()) != 0 {
+		t.Errorf("got %d entries, want the rejected one not sent", len(s.Entries()))
+	}
+}
@@ -0,0 +1,56 @@
+package quicklog
+
+import (
+	"context"
+	"time"
+)
+
+// MetaAction prefixes the actions of entries sent to Config.MetaSink.
+const MetaAction = "quicklog.meta."
+
+// metaSlots lets at most a few meta entries be in flight, so a burst of
+// failures can't pile up goroutines.
+var metaSlots = make(chan struct{}, 4)
+
+// reportMeta sends an entry describing a failure of the package itself to
+// Config.MetaSink, in the background. It never goes through the main sink,
+// and a MetaSink failure is only logged, so it can't cause more meta entries.
+func reportMeta(kind string, extra map[string]interface{}) {
+	cfg := loadSettings()
+	metaSink := cfg.MetaSink
+	if metaSink == nil {
+		return
+	}
+	select {
+	case metaSlots <- struct{}{}:
+	default:
+		return
+	}
+
+	traceCtx := TraceCtx("", "", "")
+	now := time.Now()
+	body := entryBody{
+		ProjectID: cfg.ProjectID,
+		Published: &now,
+		Level:     LevelWarn,
+		Source:    cfg.Source,
+		Type:      MetaAction + kind,
+		Context:   extra,
+		TraceID:   traceCtx.TraceID,
+		SpanID:    traceCtx.SpanID,
+	}
+	go func() {
+		defer func() { <-metaSlots }()
+		buf := getBuffer()
+		defer putBuffer(buf)
+		content, err := marshal(cfg, buf, body)
+		if err == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			err = metaSink.SendEntry(ctx, content)
+			cancel()
+		}
+		if err != nil {
+			logf("quicklog: meta sink failed for %s: %v", body.Type, err)
+		}
+	}()
+}
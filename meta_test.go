@@ -0,0 +1,31 @@
+package quicklog
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"testing"
+)
+
+func TestMetaSinkReportsDetachedFailures(t *testing.T) {
+	s := newTestServer(t)
+	s.Handler = func(w http.ResponseWriter, r *http.Request, body []byte) { w.WriteHeader(http.StatusBadRequest) }
+	meta := &recordingSink{}
+	configureTest(t, s, Config{MetaSink: meta, ErrorLog: log.New(ioutil.Discard, "", 0)})
+	LogDetached("failing", "", "", nil, TraceCtx("", "", ""))
+
+	var e entryBody
+	waitFor(t, "a meta entry", func() bool {
+		meta.mu.Lock()
+		defer meta.mu.Unlock()
+		return len(meta.entries) == 1 && json.Unmarshal(meta.entries[0], &e) == nil
+	})
+	extra := e.Context.(map[string]interface{})
+	if e.Type != MetaAction+"send_failure" || e.Level != LevelWarn || extra["action"] != "failing" || extra["error"] == nil {
+		t.Errorf("got meta entry %+v", e)
+	}
+	if len(s.Entries()) != 1 {
+		t.Errorf("the meta entry went to the API too: %d entries", len(s.Entries()))
+	}
+}
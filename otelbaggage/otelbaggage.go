@@ -0,0 +1,35 @@
+// Package otelbaggage copies OpenTelemetry baggage into quicklog entries.
+//
+// Use it by setting the quicklog Config option:
+//
+//	quicklog.Configure(quicklog.Config{
+//		...
+//		ExtraFromContext: otelbaggage.Extra,
+//	})
+//
+// and logging with quicklog.LogContext.
+package otelbaggage
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/baggage"
+)
+
+// Key is the extra key the baggage members are stored under.
+const Key = "baggage"
+
+// Extra returns the baggage members of ctx as {"baggage": {key: value}}, or
+// nil if ctx carries no baggage. It is read for each entry, so entries always
+// reflect the baggage current at the time they are logged.
+func Extra(ctx context.Context) map[string]interface{} {
+	members := baggage.FromContext(ctx).Members()
+	if len(members) == 0 {
+		return nil
+	}
+	values := make(map[string]string, len(members))
+	for _, m := range members {
+		values[m.Key()] = m.Value()
+	}
+	return map[string]interface{}{Key: values}
+}
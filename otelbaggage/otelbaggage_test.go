@@ -0,0 +1,26 @@
+package otelbaggage
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.opentelemetry.io/otel/baggage"
+)
+
+func TestExtra(t *testing.T) {
+	if extra := Extra(context.Background()); extra != nil {
+		t.Errorf("got %v without baggage, want nil", extra)
+	}
+	tenant, _ := baggage.NewMember("tenant", "acme")
+	region, _ := baggage.NewMember("region", "eu")
+	b, err := baggage.New(tenant, region)
+	if err != nil {
+		t.Fatal(err)
+	}
+	extra := Extra(baggage.ContextWithBaggage(context.Background(), b))
+	want := map[string]interface{}{Key: map[string]string{"tenant": "acme", "region": "eu"}}
+	if !reflect.DeepEqual(extra, want) {
+		t.Errorf("got %v, want %v", extra, want)
+	}
+}
@@ -0,0 +1,224 @@
+// Package otlp sends quicklog entries to an OpenTelemetry OTLP/HTTP logs
+// endpoint using the JSON encoding, so it needs no protobuf dependency.
+//
+// Use it as the quicklog Sink:
+//
+//	quicklog.Configure(quicklog.Config{
+//		ProjectID: 12345,
+//		Source:    "my-program",
+//		Sink:      &otlp.Sink{URL: "http://localhost:4318/v1/logs"},
+//	})
+//
+// The Sink makes one request per entry or tag through quicklog.PostEntry and
+// PostTag, so quicklog's Client, MaxRetries, Backoff, Retry-After handling,
+// MaxInFlight, RequestSigner, OnRequest and OnResponse all apply to it.
+package otlp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	quicklog "github.com/quicklog-io/quicklog-go"
+)
+
+// Sink is a quicklog.Sink that posts each entry and tag as an OTLP log record.
+type Sink struct {
+	URL    string
+	Header http.Header
+}
+
+// entry has the fields of a quicklog entry body.
+type entry struct {
+	ProjectID    int                    `json:"project_id"`
+	Published    *time.Time             `json:"published"`
+	Level        string                 `json:"level"`
+	Source       string                 `json:"source"`
+	Actor        string                 `json:"actor"`
+	Type         string                 `json:"type"`
+	Object       string                 `json:"object"`
+	Target       string                 `json:"target"`
+	Context      map[string]interface{} `json:"context"`
+	TraceID      string                 `json:"trace_id"`
+	ParentSpanID string                 `json:"parent_span_id"`
+	SpanID       string                 `json:"span_id"`
+	Links        []string               `json:"links"`
+}
+
+type tag struct {
+	ProjectID int    `json:"project_id"`
+	TraceID   string `json:"trace_id"`
+	Tag       string `json:"tag"`
+}
+
+// The OTLP/HTTP JSON logs request, trimmed to the fields used here.
+type (
+	LogsRequest struct {
+		ResourceLogs []ResourceLogs `json:"resourceLogs"`
+	}
+	ResourceLogs struct {
+		Resource  Resource    `json:"resource"`
+		ScopeLogs []ScopeLogs `json:"scopeLogs"`
+	}
+	Resource struct {
+		Attributes []KeyValue `json:"attributes"`
+	}
+	ScopeLogs struct {
+		Scope      Scope       `json:"scope"`
+		LogRecords []LogRecord `json:"logRecords"`
+	}
+	Scope struct {
+		Name string `json:"name"`
+	}
+	LogRecord struct {
+		TimeUnixNano   string     `json:"timeUnixNano,omitempty"`
+		SeverityNumber int        `json:"severityNumber,omitempty"`
+		SeverityText   string     `json:"severityText,omitempty"`
+		Body           AnyValue   `json:"body"`
+		Attributes     []KeyValue `json:"attributes,omitempty"`
+		TraceID        string     `json:"traceId,omitempty"`
+		SpanID         string     `json:"spanId,omitempty"`
+	}
+	KeyValue struct {
+		Key   string   `json:"key"`
+		Value AnyValue `json:"value"`
+	}
+	AnyValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+	}
+)
+
+var severities = map[string]int{"debug": 5, "info": 9, "warn": 13, "error": 17}
+
+// ConvertEntry converts a quicklog entry body into an OTLP logs request with one record.
+func ConvertEntry(body []byte) (*LogsRequest, error) {
+	var e entry
+	if err := json.Unmarshal(body, &e); err != nil {
+		return nil, err
+	}
+	record := LogRecord{
+		SeverityNumber: severities[e.Level],
+		SeverityText:   strings.ToUpper(e.Level),
+		Body:           stringValue(e.Type),
+		TraceID:        traceID(e.TraceID),
+		SpanID:         e.SpanID,
+	}
+	if e.Published != nil {
+		record.TimeUnixNano = strconv.FormatInt(e.Published.UnixNano(), 10)
+	}
+	record.Attributes = appendString(record.Attributes, "quicklog.actor", e.Actor)
+	record.Attributes = appendString(record.Attributes, "quicklog.object", e.Object)
+	record.Attributes = appendString(record.Attributes, "quicklog.target", e.Target)
+	record.Attributes = appendString(record.Attributes, "quicklog.parent_span_id", e.ParentSpanID)
+	record.Attributes = appendString(record.Attributes, "quicklog.links", strings.Join(e.Links, ","))
+	keys := make([]string, 0, len(e.Context))
+	for k := range e.Context {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		record.Attributes = append(record.Attributes, KeyValue{Key: k, Value: anyValue(e.Context[k])})
+	}
+	return request(e.ProjectID, e.Source, record), nil
+}
+
+// ConvertTag converts a quicklog tag body into an OTLP logs request with one
+// record whose body is "tag" and whose quicklog.tag attribute is the tag.
+func ConvertTag(body []byte) (*LogsRequest, error) {
+	var t tag
+	if err := json.Unmarshal(body, &t); err != nil {
+		return nil, err
+	}
+	record := LogRecord{
+		TimeUnixNano: strconv.FormatInt(time.Now().UnixNano(), 10),
+		Body:         stringValue("tag"),
+		Attributes:   []KeyValue{{Key: "quicklog.tag", Value: stringValue(t.Tag)}},
+		TraceID:      traceID(t.TraceID),
+	}
+	return request(t.ProjectID, "", record), nil
+}
+
+func (s *Sink) SendEntry(ctx context.Context, body []byte) error {
+	req, err := ConvertEntry(body)
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	return quicklog.PostEntry(ctx, s.URL, s.Header, content)
+}
+
+func (s *Sink) SendTag(ctx context.Context, body []byte) error {
+	req, err := ConvertTag(body)
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	return quicklog.PostTag(ctx, s.URL, s.Header, content)
+}
+
+func request(projectID int, source string, record LogRecord) *LogsRequest {
+	var attributes []KeyValue
+	attributes = appendString(attributes, "service.name", source)
+	if projectID != 0 {
+		attributes = append(attributes, KeyValue{Key: "quicklog.project_id", Value: anyValue(float64(projectID))})
+	}
+	return &LogsRequest{ResourceLogs: []ResourceLogs{{
+		Resource: Resource{Attributes: attributes},
+		ScopeLogs: []ScopeLogs{{
+			Scope:      Scope{Name: "quicklog-go"},
+			LogRecords: []LogRecord{record},
+		}},
+	}}}
+}
+
+// traceID left-pads quicklog's 16 hex digit trace IDs to OTLP's 32.
+func traceID(id string) string {
+	if id != "" && len(id) < 32 {
+		return strings.Repeat("0", 32-len(id)) + id
+	}
+	return id
+}
+
+func appendString(attributes []KeyValue, key, value string) []KeyValue {
+	if value == "" {
+		return attributes
+	}
+	return append(attributes, KeyValue{Key: key, Value: stringValue(value)})
+}
+
+func stringValue(s string) AnyValue {
+	return AnyValue{StringValue: &s}
+}
+
+// anyValue converts a decoded JSON value; objects and arrays are kept as JSON strings.
+func anyValue(v interface{}) AnyValue {
+	switch v := v.(type) {
+	case string:
+		return stringValue(v)
+	case bool:
+		return AnyValue{BoolValue: &v}
+	case float64:
+		if v == float64(int64(v)) {
+			i := strconv.FormatInt(int64(v), 10)
+			return AnyValue{IntValue: &i}
+		}
+		return AnyValue{DoubleValue: &v}
+	case nil:
+		return stringValue("")
+	}
+	content, _ := json.Marshal(v)
+	return stringValue(string(content))
+}
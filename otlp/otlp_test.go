@@ -0,0 +1,100 @@
+package otlp
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	quicklog "github.com/quicklog-io/quicklog-go"
+)
+
+func TestConvertEntry(t *testing.T) {
+	body := `{"project_id":7,"published":"2024-01-02T15:04:05Z","level":"warn","source":"svc","actor":"user:1",
+		"type":"a-type","object":"object:1","context":{"n":2,"f":1.5,"ok":true,"nested":{"k":"v"}},
+		"trace_id":"0123456789abcdef","span_id":"1111111111111111"}`
+	req, err := ConvertEntry([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resource := req.ResourceLogs[0].Resource.Attributes
+	if len(resource) != 2 || *resource[0].Value.StringValue != "svc" || *resource[1].Value.IntValue != "7" {
+		t.Errorf("got resource attributes %+v", resource)
+	}
+	r := req.ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	if r.SeverityNumber != 13 || r.SeverityText != "WARN" || *r.Body.StringValue != "a-type" {
+		t.Errorf("got record %+v", r)
+	}
+	if r.TraceID != "00000000000000000123456789abcdef" || r.SpanID != "1111111111111111" || r.TimeUnixNano != "1704207845000000000" {
+		t.Errorf("got record %+v", r)
+	}
+	attributes := map[string]AnyValue{}
+	for _, kv := range r.Attributes {
+		attributes[kv.Key] = kv.Value
+	}
+	if *attributes["quicklog.actor"].StringValue != "user:1" || *attributes["n"].IntValue != "2" ||
+		*attributes["f"].DoubleValue != 1.5 || !*attributes["ok"].BoolValue || *attributes["nested"].StringValue != `{"k":"v"}` {
+		t.Errorf("got attributes %+v", r.Attributes)
+	}
+	if _, ok := attributes["quicklog.target"]; ok {
+		t.Error("an empty target was sent")
+	}
+}
+
+func TestSink(t *testing.T) {
+	var got []LogsRequest
+	var headers []http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var req LogsRequest
+		json.Unmarshal(body, &req)
+		got = append(got, req)
+		headers = append(headers, r.Header)
+	}))
+	defer server.Close()
+	s := &Sink{URL: server.URL, Header: http.Header{"Authorization": {"Bearer x"}}}
+	if err := s.SendTag(context.Background(), []byte(`{"project_id":7,"trace_id":"0123456789abcdef","tag":"k:v"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || headers[0].Get("Authorization") != "Bearer x" || headers[0].Get("Content-Type") != "application/json" {
+		t.Fatalf("got %+v with headers %v", got, headers)
+	}
+	r := got[0].ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	if *r.Body.StringValue != "tag" || *r.Attributes[0].Value.StringValue != "k:v" {
+		t.Errorf("got record %+v", r)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad", http.StatusBadRequest)
+	}))
+	defer failing.Close()
+	s.URL = failing.URL
+	if err := s.SendEntry(context.Background(), []byte(`{"type":"a"}`)); err == nil {
+		t.Error("a 400 response wasn't returned as an error")
+	}
+}
+
+func TestSinkRetries(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	s := &Sink{URL: server.URL}
+	if err := quicklog.Configure(quicklog.Config{ProjectID: 7, Sink: s, MaxRetries: 1, Backoff: quicklog.ConstantBackoff{}}); err != nil {
+		t.Fatal(err)
+	}
+	defer quicklog.Configure(quicklog.Config{})
+	if err := quicklog.Log(quicklog.Entry{Action: "a", Ctx: quicklog.TraceCtx("", "", "")}); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 {
+		t.Errorf("got %d attempts, want the 503 retried once", attempts)
+	}
+}
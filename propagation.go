@@ -0,0 +1,140 @@
+package quicklog
+
+import (
+	"net/http"
+	"strings"
+)
+
+// PropagationFormat reads and writes the headers that carry a trace between
+// services. Config.Propagation selects the formats used by CtxFromRequest and
+// Transport.
+type PropagationFormat interface {
+	// Inject sets the headers continuing c's trace with c.SpanID as the parent.
+	Inject(h http.Header, c Ctx)
+	// Extract returns the trace ID and parent span ID carried by h, if any.
+	Extract(h http.Header) (traceID, spanID string, ok bool)
+}
+
+var (
+	// W3CFormat is the W3C 'traceparent' header. 16 digit trace IDs are
+	// zero padded to 32 digits, and the padding is removed when extracted.
+	W3CFormat PropagationFormat = w3cFormat{}
+	// B3Format is the multi-header B3 form ('X-B3-TraceId', 'X-B3-SpanId', ...),
+	// as sent by the quicklog JS client. Extract also reads the single 'b3' header.
+	B3Format PropagationFormat = b3Format{}
+	// B3SingleFormat is the single 'b3' header, 'traceid-spanid-1[-parentspanid]'.
+	B3SingleFormat PropagationFormat = b3SingleFormat{}
+)
+
+// defaultPropagation is used when Config.Propagation is empty.
+var defaultPropagation = []PropagationFormat{W3CFormat, B3Format}
+
+func propagation() []PropagationFormat {
+	if formats := loadSettings().Propagation; len(formats) > 0 {
+		return formats
+	}
+	return defaultPropagation
+}
+
+type w3cFormat struct{}
+
+func (w3cFormat) Inject(h http.Header, c Ctx) {
+	traceID := c.TraceID
+	if len(traceID) == 16 {
+		traceID = zeroPad + traceID
+	}
+	h.Set("traceparent", "00-"+traceID+"-"+c.SpanID+"-01")
+}
+
+func (w3cFormat) Extract(h http.Header) (string, string, bool) {
+	return parseTraceparent(h.Get("traceparent"))
+}
+
+type b3Format struct{}
+
+func (b3Format) Inject(h http.Header, c Ctx) {
+	h.Set("X-B3-TraceId", c.TraceID)
+	h.Set("X-B3-SpanId", c.SpanID)
+	if c.ParentSpanID != "" {
+		h.Set("X-B3-ParentSpanId", c.ParentSpanID)
+	} else {
+		h.Del("X-B3-ParentSpanId")
+	}
+	h.Set("X-B3-Sampled", "1")
+}
+
+func (b3Format) Extract(h http.Header) (string, string, bool) {
+	return parseB3(h)
+}
+
+type b3SingleFormat struct{}
+
+func (b3SingleFormat) Inject(h http.Header, c Ctx) {
+	value := c.TraceID + "-" + c.SpanID + "-1"
+	if c.ParentSpanID != "" {
+		value += "-" + c.ParentSpanID
+	}
+	h.Set("b3", value)
+}
+
+func (b3SingleFormat) Extract(h http.Header) (string, string, bool) {
+	if h.Get("b3") == "" {
+		return "", "", false
+	}
+	return parseB3(h)
+}
+
+// parseTraceparent parses a W3C header of the form 'version-traceid-spanid-flags'.
+func parseTraceparent(value string) (string, string, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return "", "", false
+	}
+	traceID, spanID := parts[1], parts[2]
+	if !isHexID(traceID, 32) || !isHexID(spanID, 16) {
+		return "", "", false
+	}
+	// Undo the padding of 16 digit trace IDs by W3CFormat.Inject.
+	if strings.HasPrefix(traceID, zeroPad) {
+		traceID = traceID[len(zeroPad):]
+	}
+	return traceID, spanID, true
+}
+
+const zeroPad = "0000000000000000"
+
+// parseB3 parses either the single 'b3' header or the multi-header form.
+func parseB3(h http.Header) (string, string, bool) {
+	traceID, spanID := h.Get("X-B3-TraceId"), h.Get("X-B3-SpanId")
+	if single := h.Get("b3"); single != "" {
+		parts := strings.Split(single, "-")
+		if len(parts) < 2 {
+			return "", "", false
+		}
+		traceID, spanID = parts[0], parts[1]
+	}
+	if !(isHexID(traceID, 16) || isHexID(traceID, 32)) || !isHexID(spanID, 16) {
+		return "", "", false
+	}
+	return traceID, spanID, true
+}
+
+// isHexID reports whether id is a non-zero lowercase hex string of the given length.
+func isHexID(id string, length int) bool {
+	if len(id) != length || strings.Trim(id, "0") == "" {
+		return false
+	}
+	for _, c := range id {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// injectHeaders sets the headers of each Config.Propagation format.
+func injectHeaders(h http.Header, c Ctx) {
+	for _, f := range propagation() {
+		f.Inject(h, c)
+	}
+}
@@ -0,0 +1,55 @@
+package quicklog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPropagationRoundTrips(t *testing.T) {
+	c := Ctx{TraceID: "0123456789abcdef", SpanID: "2222222222222222", ParentSpanID: "1111111111111111"}
+	for name, f := range map[string]PropagationFormat{"w3c": W3CFormat, "b3": B3Format, "b3 single": B3SingleFormat} {
+		h := http.Header{}
+		f.Inject(h, c)
+		traceID, spanID, ok := f.Extract(h)
+		if !ok || traceID != c.TraceID || spanID != c.SpanID {
+			t.Errorf("%s: extracted %q, %q, %v from %v", name, traceID, spanID, ok, h)
+		}
+		if _, _, ok := f.Extract(http.Header{}); ok {
+			t.Errorf("%s: extracted a trace from no headers", name)
+		}
+	}
+
+	h := http.Header{}
+	B3SingleFormat.Inject(h, c)
+	if got := h.Get("b3"); got != "0123456789abcdef-2222222222222222-1-1111111111111111" {
+		t.Errorf("got b3 header %q", got)
+	}
+	h = http.Header{}
+	B3SingleFormat.Inject(h, Ctx{TraceID: c.TraceID, SpanID: c.SpanID})
+	if got := h.Get("b3"); got != "0123456789abcdef-2222222222222222-1" {
+		t.Errorf("got b3 header %q for a root span", got)
+	}
+}
+
+func TestPropagationOrder(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("traceparent", "00-00000000000000000123456789abcdef-1111111111111111-01")
+	r.Header.Set("b3", "fedcba9876543210-2222222222222222-1")
+
+	configureTest(t, nil, Config{})
+	if c := CtxFromRequest(r, nil); c.TraceID != "0123456789abcdef" {
+		t.Errorf("got trace %q, want traceparent's by default", c.TraceID)
+	}
+	configureTest(t, nil, Config{Propagation: []PropagationFormat{B3SingleFormat, W3CFormat}})
+	if c := CtxFromRequest(r, nil); c.TraceID != "fedcba9876543210" || c.ParentSpanID != "2222222222222222" {
+		t.Errorf("got %+v, want the b3 header's trace first", c)
+	}
+
+	configureTest(t, nil, Config{Propagation: []PropagationFormat{B3SingleFormat}})
+	h := http.Header{}
+	injectHeaders(h, Ctx{TraceID: "0123456789abcdef", SpanID: "2222222222222222"})
+	if h.Get("traceparent") != "" || h.Get("X-B3-TraceId") != "" || h.Get("b3") == "" {
+		t.Errorf("got headers %v, want only b3", h)
+	}
+}
@@ -2,13 +2,26 @@ package quicklog
 
 import (
 	"bytes"
+	"container/list"
+	"context"
+	crand "crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"log"
 	"math/rand"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,8 +31,207 @@ type Config struct {
 	ApiKey    string
 	ApiURL    string
 	Client    *http.Client
+	// MinLevel drops entries logged below this level. Entries logged
+	// without a level are always sent.
+	MinLevel Level
+	// MaxRetries is how many times a failed request is retried on network
+	// errors, 429 and 5xx responses. A Retry-After header is honored.
+	MaxRetries int
+	// DisableEntryRetries and DisableTagRetries turn off MaxRetries for
+	// entries or tags only, e.g. to retry just the (idempotent) tags.
+	DisableEntryRetries bool
+	DisableTagRetries   bool
+	// RetryDelay is the initial backoff between retries, doubled on each
+	// attempt. Defaults to 100ms.
+	RetryDelay time.Duration
+	// Backoff, when set, chooses the delays between retries in place of
+	// RetryDelay.
+	Backoff Backoff
+	// HostMetadata adds the hostname, PID and the HostEnv variables to the
+	// extra of every entry under the "_host" key.
+	HostMetadata bool
+	HostEnv      []string
+	// LargeValueStore, when set, stores extra values whose JSON encoding is
+	// larger than LargeValueThreshold bytes (default 4096) and sends a
+	// {"_ref": url} reference in their place.
+	LargeValueStore     LargeValueStore
+	LargeValueThreshold int
+	// ValidateSchema checks each entry against entry.schema.json before it is
+	// sent. It is meant for development and is off by default.
+	ValidateSchema bool
+	// Sink receives entries and tags in place of the quicklog API, e.g. a
+	// ConsoleSink for local development.
+	Sink Sink
+	// MetaSink, when set, receives entries describing entries that LogDetached
+	// dropped or failed to send. It should be separate from Sink and the API.
+	MetaSink Sink
+	// DetachContext makes LogContext ignore the cancellation and deadline of
+	// the context it is given, using DetachTimeout (default 5s) instead, so a
+	// request ending doesn't lose its entries. Context values are kept.
+	// DetachTimeout also bounds LogDetached sends.
+	DetachContext bool
+	DetachTimeout time.Duration
+	// MaxDetached is how many LogDetached entries may be pending at once (default 64).
+	MaxDetached int
+	// ExtraFromContext returns extra values to add to every entry logged with
+	// LogContext (see the otelbaggage package). Keys in the entry's own extra win.
+	ExtraFromContext func(ctx context.Context) map[string]interface{}
+	// Propagation lists the trace header formats CtxFromRequest reads (first
+	// match wins) and Transport writes. Defaults to W3CFormat and B3Format.
+	Propagation []PropagationFormat
+	// MaxTagsPerTrace limits how many tags one TagTrace (or Quicklog) call
+	// sends. Zero means no limit.
+	MaxTagsPerTrace int
+	// UseServerTime leaves out the published time so the backend stamps
+	// entries with its own receive time, avoiding client clock skew.
+	UseServerTime bool
+	// EntriesURL and TagsURL replace ApiURL+"/entries" and ApiURL+"/tags".
+	EntriesURL string
+	TagsURL    string
+	// RequireQualifiedIDs rejects entries whose non-empty object or target
+	// isn't of the form 'kind:id' (see ID).
+	RequireQualifiedIDs bool
+	// UserAgent is appended to the "quicklog-go/<version>" User-Agent,
+	// e.g. "myservice/1.2.3".
+	UserAgent string
+	// RawBinary sends []byte extra values with encoding/json's plain base64
+	// string instead of the {"_b64": "..."} marker object.
+	RawBinary bool
+	// AllowKeys, when set, removes every extra key not in the list before an
+	// entry is sent, including keys added by options such as HostMetadata.
+	// See StrippedKeys.
+	AllowKeys []string
+	// FieldNames renames entry body fields for backends that expect other
+	// names, e.g. {"type": "event_type", "context": "ctx"}.
+	FieldNames map[string]string
+	// Enabled, when set, is called for each entry and the entry is dropped if
+	// it returns false, e.g. to gate logging behind a feature flag.
+	Enabled func() bool
+	// ActorHasher, when set, is applied to each Ctx.ActorID before it is sent
+	// as the entry's actor, e.g. an HMAC to pseudonymize user IDs. The Ctx
+	// itself keeps the raw ID.
+	ActorHasher func(actorID string) string
+	// ErrorLog receives problems that can't be returned to a caller. If nil,
+	// the log package's standard logger is used.
+	ErrorLog *log.Logger
+	// OnRequest and OnResponse are called around each HTTP request, e.g. to
+	// dump them while debugging. OnRequest may read req.Body, which is reset
+	// from req.GetBody before it is sent, and reading resp.Body doesn't
+	// affect the client.
+	OnRequest  func(req *http.Request)
+	OnResponse func(resp *http.Response, elapsed time.Duration)
+	// TLSConfig, RootCAFile (a PEM file of extra CAs to trust) and
+	// InsecureSkipVerify (for development only) configure TLS for the
+	// client built when Client is nil.
+	TLSConfig          *tls.Config
+	RootCAFile         string
+	InsecureSkipVerify bool
+	// MaxClockSkew is how far in the future an entry's published time may
+	// be before FuturePolicy applies.
+	MaxClockSkew time.Duration
+	FuturePolicy SkewPolicy
+	// ActionRates limits how often entries with the given actions are sent;
+	// entries beyond the limit are dropped. Other actions are limited by
+	// DefaultActionRate, which by default doesn't limit them.
+	ActionRates       map[string]Rate
+	DefaultActionRate Rate
+	// ActorRates limits how often entries from the given ActorIDs are sent,
+	// so one busy actor can't dominate; other actors, including an empty
+	// one, are each limited by DefaultActorRate. Entries beyond it are dropped.
+	ActorRates       map[string]Rate
+	DefaultActorRate Rate
+	// MaxInFlight limits how many HTTP requests may be outstanding at once.
+	// When the limit is reached, requests wait for a free slot (or for their
+	// context to be done), or fail with ErrTooManyInFlight if FailFast is set.
+	MaxInFlight int
+	FailFast    bool
+	// Marshaler replaces encoding/json for entry and tag bodies, e.g. with a
+	// faster library's Marshal. It must produce the same JSON.
+	Marshaler func(v interface{}) ([]byte, error)
+	// TagCacheSize, when set, remembers that many recently sent (trace, tag)
+	// pairs and skips sending them again. TagCache, when set, is used instead,
+	// e.g. a store shared between processes.
+	TagCacheSize int
+	TagCache     Cache
+	// ClassifyError, when set, returns extra tags for errors logged with
+	// LogError and LogWarn, e.g. "error_class:timeout".
+	ClassifyError func(err error) []string
+	// ControlChars is what to do with control characters such as NUL, \n or
+	// \t in an entry's action, object, target and actor. By default they are sent.
+	ControlChars ControlCharPolicy
+	// BeforeSend hooks run in order on each entry that passes MinLevel,
+	// Enabled and ActionRates, and may change it. A hook returning false drops
+	// the entry without running the rest. AfterSend hooks then run in order
+	// with the entry and the error Log returns, whether or not it failed,
+	// unless DedupeWindow skipped it as a duplicate.
+	BeforeSend []func(e *Entry) bool
+	AfterSend  []func(e Entry, err error)
+	// Envelope, when set, wraps each entry body before it is sent, e.g.
+	// func(body interface{}) interface{} { return map[string]interface{}{"v": 1, "payload": body} }.
+	// body is the entry's JSON (a json.RawMessage), after ValidateSchema and FieldNames.
+	Envelope func(body interface{}) interface{}
+	// AdaptiveTimeout, when set, replaces Client's Timeout with one based on
+	// recent request latency. An entry's own Timeout still wins. Configure
+	// returns an error if its Min is more than its Max.
+	AdaptiveTimeout *AdaptiveTimeout
+	// DedupeWindow, when set, skips entries whose DedupeKey was logged less
+	// than that long ago. DedupeCacheSize bounds how many keys are remembered
+	// (default 1024); DedupeCache, when set, is used instead, e.g. a store
+	// shared between processes. A key whose entry fails is forgotten so it can
+	// be retried.
+	DedupeWindow    time.Duration
+	DedupeCacheSize int
+	DedupeCache     Cache
+	// RequestSigner, when set, is called for each entry and tag request (each
+	// attempt), and Diagnose's sample entry, with the exact body being sent,
+	// e.g. to add an HMAC signature header. An error fails the request without
+	// retrying it.
+	RequestSigner func(req *http.Request, body []byte) error
+	// DeadlineRemaining adds extra {"deadline_remaining_ms"} to entries logged
+	// with LogContext whose context has a deadline: how long was left when the
+	// entry was logged (negative once it has passed). The entry's own key wins.
+	DeadlineRemaining bool
+	// MaxExtraDepth limits how deeply maps, structs, slices and arrays of any
+	// type may nest in an entry's extra (the extra itself is depth 1), and
+	// MaxExtraKeys how many map keys, struct fields and items it may have in
+	// all. Pointers and interfaces are followed. Beyond them, and at reference
+	// cycles, keys and items are dropped (nested values become null) and
+	// {"_truncated": true} is added, or the entry is rejected if
+	// RejectLargeExtra is set. A truncated extra is sent with its structs as
+	// objects of their JSON fields. Zero means no limit.
+	MaxExtraDepth    int
+	MaxExtraKeys     int
+	RejectLargeExtra bool
+	// EmitLifecycleEvents logs a StartupAction entry (with the library
+	// version, host and a config summary) the first time Configure is called,
+	// and a ShutdownAction entry in Close, both in a trace of their own.
+	EmitLifecycleEvents bool
+	// OnTimings, when set, is called after each entry is sent (or fails to
+	// be) with how long it took to serialize and to send, e.g. to record them
+	// in histograms.
+	OnTimings func(e Entry, t Timings)
 }
 
+// Timings splits the time taken to log an entry, for Config.OnTimings.
+type Timings struct {
+	// Serialize is the time spent building the JSON body: marshaling, plus
+	// ValidateSchema, FieldNames and Envelope if set.
+	Serialize time.Duration
+	// Send is the time spent in the Sink, including retries and their waits.
+	Send time.Duration
+	// Size is the length of the body sent, in bytes.
+	Size int
+}
+
+// SkewPolicy is what to do with an entry published further in the future than Config.MaxClockSkew.
+type SkewPolicy int
+
+const (
+	SkewPassThrough SkewPolicy = iota // send it unchanged
+	SkewClamp                         // send it with the published time set to now
+	SkewReject                        // return an error
+)
+
 type Ctx struct {
 	ActorID      string
 	TraceID      string
@@ -27,18 +239,167 @@ type Ctx struct {
 	SpanID       string
 }
 
+// traceState is the in-process state of a trace, shared by every Ctx with
+// its TraceID however the Ctx was made.
+type traceState struct {
+	traceID string
+	seq     uint64
+
+	mu           sync.Mutex
+	originSpanID string
+}
+
+// maxTraceStates bounds how many traces' state is kept. The state of the
+// least recently logged trace is forgotten first, so an entry in a trace
+// idle for that long starts its seq over at 1.
+const maxTraceStates = 10000
+
+var (
+	traceStatesMu sync.Mutex
+	traceOrder    = list.New() // of *traceState, most recently used first
+	traceStates   = make(map[string]*list.Element)
+)
+
+// stateOf returns the state of the trace traceID, or nil if it is empty.
+func stateOf(traceID string) *traceState {
+	if traceID == "" {
+		return nil
+	}
+	traceStatesMu.Lock()
+	defer traceStatesMu.Unlock()
+	if el, ok := traceStates[traceID]; ok {
+		traceOrder.MoveToFront(el)
+		return el.Value.(*traceState)
+	}
+	state := &traceState{traceID: traceID}
+	traceStates[traceID] = traceOrder.PushFront(state)
+	if traceOrder.Len() > maxTraceStates {
+		oldest := traceOrder.Back()
+		traceOrder.Remove(oldest)
+		delete(traceStates, oldest.Value.(*traceState).traceID)
+	}
+	return state
+}
+
+// origin returns the span in which an error was first logged in the trace,
+// recording spanID as that span if there isn't one yet.
+func (s *traceState) origin(spanID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.originSpanID == "" {
+		s.originSpanID = spanID
+	}
+	return s.originSpanID
+}
+
+/**
+ * Creates a Ctx for a child span of c in the same trace. Entries logged in
+ * the trace by this process, with any Ctx, are numbered in order by their
+ * 'seq' field.
+ * @return Ctx
+ */
+func (c Ctx) Child() Ctx {
+	return TraceCtx(c.ActorID, c.TraceID, c.SpanID)
+}
+
+/**
+ * Creates a Ctx starting a new trace for the same actor as c, e.g. for each
+ * unrelated task of a long-lived worker. Unlike Child it shares nothing else
+ * with c: the trace has its own seq numbering and no parent span.
+ * @return Ctx
+ */
+func (c Ctx) NewTrace() Ctx {
+	return TraceCtx(c.ActorID, "", "")
+}
+
+// Entry is a single log entry, as sent by Log.
+type Entry struct {
+	Published time.Time
+	Level     Level
+	Action    string
+	Object    string
+	Target    string
+	Extra     map[string]interface{}
+	Ctx       Ctx
+	Tags      []string
+	// ProjectID overrides Config.ProjectID for this entry and its tags.
+	ProjectID int
+	// Timeout overrides the Client's Timeout for each request made for this
+	// entry. A deadline on the context passed to LogContext still applies,
+	// so the earlier of the two wins.
+	Timeout time.Duration
+	// Links are traces or spans, formatted "traceID" or "traceID:spanID",
+	// that this entry causally relates to, e.g. the producer of a queued job.
+	Links []string
+	// Events are timestamped sub-events within the entry's span, in order.
+	Events []SpanEvent
+	// RetentionDays asks the backend to keep the entry for this many days.
+	// Zero leaves retention to the backend's default.
+	RetentionDays int
+	// OnDelivered, when set, is called once with the result of sending the
+	// entry when its last attempt (retries included) is done, before its tags
+	// are sent, or with the error that stopped it being sent (e.g. a
+	// validation error), or ErrDropped if a rate limit, DedupeWindow,
+	// BeforeSend or MaxDetached dropped it. For LogDetached entries it runs
+	// in the background goroutine. It isn't called for entries filtered out
+	// by MinLevel or Enabled, or logged while sending is disabled.
+	OnDelivered func(err error)
+	// DedupeKey, when set, is a natural key for the event, e.g. an order ID.
+	// With Config.DedupeWindow set, an entry whose key was sent within the
+	// window is skipped.
+	DedupeKey string
+}
+
+// SpanEvent is something that happened at a point in time within a span.
+type SpanEvent struct {
+	Time       time.Time              `json:"time"`
+	Name       string                 `json:"name"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+/**
+ * Returns a copy of the entry with an event, timestamped now, added after any existing ones.
+ * @param {string} name
+ * @param {map} attrs (may be nil)
+ * @return Entry
+ */
+func (e Entry) AddEvent(name string, attrs map[string]interface{}) Entry {
+	e.Events = append(e.Events[:len(e.Events):len(e.Events)], SpanEvent{Time: time.Now(), Name: name, Attributes: attrs})
+	return e
+}
+
+/**
+ * Returns a copy of the entry linked to another trace or span.
+ * @param {string} traceID
+ * @param {string} spanID (may be empty to link the whole trace)
+ * @return Entry
+ */
+func (e Entry) Link(traceID, spanID string) Entry {
+	link := traceID
+	if spanID != "" {
+		link += ":" + spanID
+	}
+	e.Links = append(e.Links[:len(e.Links):len(e.Links)], link)
+	return e
+}
+
 type entryBody struct {
-	ProjectID    int         `json:"project_id"`
-	Published    time.Time   `json:"published"`
-	Source       string      `json:"source"`
-	Actor        string      `json:"actor"`
-	Type         string      `json:"type"`
-	Object       string      `json:"object"`
-	Target       string      `json:"target"`
-	Context      interface{} `json:"context"`
-	TraceID      string      `json:"trace_id"`
-	ParentSpanID string      `json:"parent_span_id"`
-	SpanID       string      `json:"span_id"`
+	ProjectID     int         `json:"project_id"`
+	Published     *time.Time  `json:"published,omitempty"`
+	Level         Level       `json:"level,omitempty"`
+	Source        string      `json:"source"`
+	Actor         string      `json:"actor"`
+	Type          string      `json:"type"`
+	Object        string      `json:"object"`
+	Target        string      `json:"target"`
+	Context       interface{} `json:"context"`
+	TraceID       string      `json:"trace_id"`
+	ParentSpanID  string      `json:"parent_span_id"`
+	SpanID        string      `json:"span_id"`
+	Links         []string    `json:"links,omitempty"`
+	Events        []SpanEvent `json:"events,omitempty"`
+	RetentionDays int         `json:"retention_days,omitempty"`
+	Seq           uint64      `json:"seq,omitempty"`
 }
 
 type tagBody struct {
@@ -47,27 +408,248 @@ type tagBody struct {
 	Tag       string `json:"tag"`
 }
 
+// Version is the version of this library, sent in the User-Agent header.
+const Version = "0.1.0"
+
+// ErrTooManyTags is returned when a call has more tags than Config.MaxTagsPerTrace.
+// The tags up to the limit have been sent.
+var ErrTooManyTags = errors.New("too many tags for one trace")
+
+// ErrDropped is passed to Entry.OnDelivered when an entry is dropped without
+// an error, e.g. by a rate limit or as a duplicate.
+var ErrDropped = errors.New("entry dropped")
+
+// ErrTooManyInFlight is returned when Config.FailFast is set and
+// Config.MaxInFlight requests are already in flight.
+var ErrTooManyInFlight = errors.New("too many requests in flight")
+
+// ErrDisabled is returned by the calls that only read from the API, such as
+// GetTrace, and reported by Diagnose, when sending is disabled.
+var ErrDisabled = errors.New("quicklog is disabled")
+
+// settings is a Config as applied by Configure, with the state derived from
+// it. Configure publishes a new one instead of changing the current one, and a
+// send uses the one it started with throughout (see withSettings), so calling
+// Configure again doesn't affect entries already being sent or LogDetached
+// entries already queued.
+type settings struct {
+	Config
+	hostMetadata  map[string]interface{}
+	allowKeys     map[string]bool
+	actionLimiter *rateLimiter
+	actorLimiter  *rateLimiter
+	inFlightSlots chan struct{}
+	sentTags      Cache
+	dedupeKeys    Cache
+	// detachedSlots bounds the number of LogDetached entries not yet sent.
+	detachedSlots chan struct{}
+}
+
 var (
-	config Config
+	current     atomic.Value // *settings
+	configureMu sync.Mutex
+
+	strippedKeys uint64
+
+	randReader     io.Reader = crand.Reader
+	fallbackRandMu sync.Mutex
+	fallbackRand   = rand.New(rand.NewSource(time.Now().UnixNano()))
+	// fallbackLogged logs the first crypto/rand failure only.
+	fallbackLogged sync.Once
 )
 
+// disabled is set by Disable, or at startup by QUICKLOG_DISABLED.
+var disabled int32
+
 func init() {
-	rand.Seed(time.Now().UnixNano())
+	if off, _ := strconv.ParseBool(os.Getenv("QUICKLOG_DISABLED")); off {
+		disabled = 1
+	}
 }
 
-func Configure(c Config) {
-	config = c
-	if config.ApiURL == "" {
-		config.ApiURL = "https://api.quicklog.io"
+/**
+ * Turns every entry and tag call into a no-op returning nil, e.g. in tests
+ * to make sure nothing is sent. GetTrace and StreamTrace return ErrDisabled,
+ * and Diagnose stops at its config stage. Setting QUICKLOG_DISABLED=1 in the
+ * environment does the same from startup.
+ */
+func Disable() {
+	atomic.StoreInt32(&disabled, 1)
+}
+
+/**
+ * Undoes Disable (or QUICKLOG_DISABLED).
+ */
+func Enable() {
+	atomic.StoreInt32(&disabled, 0)
+}
+
+func isDisabled() bool {
+	return atomic.LoadInt32(&disabled) != 0
+}
+
+// loadSettings returns the settings made by the last Configure call.
+func loadSettings() *settings {
+	if cfg, ok := current.Load().(*settings); ok {
+		return cfg
 	}
-	if config.Client == nil {
+	return &settings{}
+}
+
+type settingsKey struct{}
+
+// withSettings makes the sends under the returned context use cfg.
+func withSettings(ctx context.Context, cfg *settings) context.Context {
+	return context.WithValue(ctx, settingsKey{}, cfg)
+}
+
+// settingsFrom returns the settings a send started with, or the current ones.
+func settingsFrom(ctx context.Context) *settings {
+	if cfg, ok := ctx.Value(settingsKey{}).(*settings); ok {
+		return cfg
+	}
+	return loadSettings()
+}
+
+// logf reports a problem that can't be returned to the caller.
+func logf(format string, args ...interface{}) {
+	if errorLog := loadSettings().ErrorLog; errorLog != nil {
+		errorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+/**
+ * Sets the global settings. An error is returned only for a bad TLS setting
+ * or AdaptiveTimeout (which is then not used); the other settings are still
+ * applied.
+ * @param {Config} c
+ * @return error
+ */
+func Configure(c Config) error {
+	configureMu.Lock()
+	defer configureMu.Unlock()
+	cfg := &settings{Config: c}
+	if cfg.ApiURL == "" {
+		cfg.ApiURL = "https://api.quicklog.io"
+	}
+	var tlsErr error
+	if cfg.Client == nil {
 		tr := http.Transport{
 			MaxIdleConns:       5,
 			IdleConnTimeout:    30 * time.Second,
 			DisableCompression: true,
 		}
-		config.Client = &http.Client{Transport: &tr, Timeout: 3 * time.Second}
+		tr.TLSClientConfig, tlsErr = tlsConfig(cfg.Config)
+		cfg.Client = &http.Client{Transport: &tr, Timeout: 3 * time.Second}
+	}
+	if len(cfg.AllowKeys) != 0 {
+		cfg.allowKeys = make(map[string]bool, len(cfg.AllowKeys))
+		for _, k := range cfg.AllowKeys {
+			cfg.allowKeys[k] = true
+		}
+	}
+	if len(cfg.ActionRates) != 0 || cfg.DefaultActionRate.PerSecond > 0 {
+		cfg.actionLimiter = newRateLimiter(cfg.ActionRates, cfg.DefaultActionRate)
+	}
+	if len(cfg.ActorRates) != 0 || cfg.DefaultActorRate.PerSecond > 0 {
+		cfg.actorLimiter = newRateLimiter(cfg.ActorRates, cfg.DefaultActorRate)
+	}
+	if cfg.DedupeWindow > 0 {
+		cfg.dedupeKeys = cfg.DedupeCache
+		if cfg.dedupeKeys == nil {
+			size := cfg.DedupeCacheSize
+			if size <= 0 {
+				size = 1024
+			}
+			cfg.dedupeKeys = newLRUCache(size)
+		}
 	}
+	cfg.sentTags = cfg.TagCache
+	if cfg.sentTags == nil && cfg.TagCacheSize > 0 {
+		cfg.sentTags = newLRUCache(cfg.TagCacheSize)
+	}
+	var err error
+	if a := cfg.AdaptiveTimeout; a != nil && a.Max > 0 && a.Min > a.Max {
+		err = fmt.Errorf("AdaptiveTimeout Min %v must not be more than Max %v", a.Min, a.Max)
+		cfg.AdaptiveTimeout = nil
+	}
+	if cfg.MaxInFlight > 0 {
+		cfg.inFlightSlots = make(chan struct{}, cfg.MaxInFlight)
+	}
+	maxDetached := cfg.MaxDetached
+	if maxDetached <= 0 {
+		maxDetached = 64
+	}
+	// Keep counting the entries already pending against the limit.
+	if prev := loadSettings().detachedSlots; cap(prev) == maxDetached {
+		cfg.detachedSlots = prev
+	} else {
+		cfg.detachedSlots = make(chan struct{}, maxDetached)
+	}
+	if cfg.HostMetadata {
+		cfg.hostMetadata = lookupHostMetadata(cfg.HostEnv)
+	}
+	current.Store(cfg)
+	if tlsErr != nil {
+		return tlsErr
+	}
+	if cfg.EmitLifecycleEvents {
+		emitStartup(cfg)
+	}
+	return err
+}
+
+/**
+ * Returns the settings in use, including defaults filled in by Configure,
+ * e.g. to log at startup. The ApiKey is replaced by "REDACTED".
+ * @return Config
+ */
+func CurrentConfig() Config {
+	c := loadSettings().Config
+	if c.ApiKey != "" {
+		c.ApiKey = "REDACTED"
+	}
+	c.HostEnv = append([]string(nil), c.HostEnv...)
+	c.AllowKeys = append([]string(nil), c.AllowKeys...)
+	if c.FieldNames != nil {
+		names := make(map[string]string, len(c.FieldNames))
+		for k, v := range c.FieldNames {
+			names[k] = v
+		}
+		c.FieldNames = names
+	}
+	return c
+}
+
+// tlsConfig returns the TLS settings of the internally built transport.
+func tlsConfig(c Config) (*tls.Config, error) {
+	if c.TLSConfig == nil && c.RootCAFile == "" && !c.InsecureSkipVerify {
+		return nil, nil
+	}
+	tc := &tls.Config{}
+	if c.TLSConfig != nil {
+		tc = c.TLSConfig.Clone()
+	}
+	if c.InsecureSkipVerify {
+		tc.InsecureSkipVerify = true
+	}
+	if c.RootCAFile != "" {
+		pem, err := ioutil.ReadFile(c.RootCAFile)
+		if err != nil {
+			return tc, err
+		}
+		if tc.RootCAs == nil {
+			if tc.RootCAs, err = x509.SystemCertPool(); err != nil {
+				tc.RootCAs = x509.NewCertPool()
+			}
+		}
+		if !tc.RootCAs.AppendCertsFromPEM(pem) {
+			return tc, fmt.Errorf("no certificates found in RootCAFile %q", c.RootCAFile)
+		}
+	}
+	return tc, nil
 }
 
 /**
@@ -81,50 +663,405 @@ func Configure(c Config) {
  * @return error
  */
 func Quicklog(published time.Time, action, object, target string, extra map[string]interface{}, traceCtx Ctx, tags ...string) error {
-	if config.ProjectID == 0 {
+	return Log(Entry{Published: published, Action: action, Object: object, Target: target, Extra: extra, Ctx: traceCtx, Tags: tags})
+}
+
+/**
+ * Same as Quicklog, but each request uses timeout in place of the Client's Timeout.
+ * @param {time.Duration} timeout
+ * @return error
+ */
+func QuicklogWithTimeout(timeout time.Duration, published time.Time, action, object, target string, extra map[string]interface{}, traceCtx Ctx, tags ...string) error {
+	return Log(Entry{Published: published, Action: action, Object: object, Target: target, Extra: extra, Ctx: traceCtx, Tags: tags, Timeout: timeout})
+}
+
+/**
+ * Same as Quicklog, but extraFunc is only called to build the extra if the
+ * entry will be sent (see Config.Enabled and Config.MinLevel).
+ * @param {func} extraFunc returns the extra
+ * @return error
+ */
+func LogFunc(traceCtx Ctx, action, object, target string, extraFunc func() map[string]interface{}, tags ...string) error {
+	e := Entry{Published: time.Now(), Action: action, Object: object, Target: target, Ctx: traceCtx, Tags: tags}
+	return logContext(context.Background(), e, extraFunc)
+}
+
+/**
+ * Creates a quicklog entry with level 'debug'. Parameters are the same as for Quicklog.
+ * @return error
+ */
+func Debug(published time.Time, action, object, target string, extra map[string]interface{}, traceCtx Ctx, tags ...string) error {
+	return Log(Entry{Published: published, Level: LevelDebug, Action: action, Object: object, Target: target, Extra: extra, Ctx: traceCtx, Tags: tags})
+}
+
+/**
+ * Creates a quicklog entry with level 'info'. Parameters are the same as for Quicklog.
+ * @return error
+ */
+func Info(published time.Time, action, object, target string, extra map[string]interface{}, traceCtx Ctx, tags ...string) error {
+	return Log(Entry{Published: published, Level: LevelInfo, Action: action, Object: object, Target: target, Extra: extra, Ctx: traceCtx, Tags: tags})
+}
+
+/**
+ * Creates a quicklog entry with level 'warn'. Parameters are the same as for Quicklog.
+ * @return error
+ */
+func Warn(published time.Time, action, object, target string, extra map[string]interface{}, traceCtx Ctx, tags ...string) error {
+	return Log(Entry{Published: published, Level: LevelWarn, Action: action, Object: object, Target: target, Extra: extra, Ctx: traceCtx, Tags: tags})
+}
+
+/**
+ * Creates a quicklog entry with level 'error'. Parameters are the same as for Quicklog.
+ * @return error
+ */
+func Error(published time.Time, action, object, target string, extra map[string]interface{}, traceCtx Ctx, tags ...string) error {
+	return Log(Entry{Published: published, Level: LevelError, Action: action, Object: object, Target: target, Extra: extra, Ctx: traceCtx, Tags: tags})
+}
+
+/**
+ * Creates a quicklog entry from an Entry. Fields left at their zero value use
+ * the Config defaults (e.g. a zero ProjectID uses Config.ProjectID), and a
+ * zero Published is the time Log is called.
+ * @param {Entry} e
+ * @return error
+ */
+func Log(e Entry) error {
+	return LogContext(context.Background(), e)
+}
+
+/**
+ * Same as Log, but retries stop and requests are cancelled when ctx is done.
+ * @param {context.Context} ctx
+ * @param {Entry} e
+ * @return error
+ */
+func LogContext(ctx context.Context, e Entry) error {
+	return logContext(ctx, e, nil)
+}
+
+// logContext sends e, first setting its Extra from extraFunc if that is not
+// nil and the entry hasn't been filtered out.
+func logContext(ctx context.Context, e Entry, extraFunc func() map[string]interface{}) (err error) {
+	if isDisabled() {
+		return nil
+	}
+	withCurrentSpan(&e)
+	cfg := settingsFrom(ctx)
+	deadline, hasDeadline := ctx.Deadline()
+	if cfg.DetachContext {
+		timeout := cfg.DetachTimeout
+		if timeout <= 0 {
+			timeout = 5 * time.Second
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(detach(ctx), timeout)
+		defer cancel()
+	}
+	ctx = withSettings(ctx, cfg)
+	if e.Timeout > 0 {
+		ctx = withTimeout(ctx, e.Timeout)
+	}
+	if !shouldSend(cfg, e) {
+		return nil
+	}
+	// From here on every outcome reaches OnDelivered, drops as ErrDropped.
+	delivered, dropped := false, false
+	defer func() {
+		if e.OnDelivered != nil && !delivered {
+			if dropped {
+				e.OnDelivered(ErrDropped)
+			} else {
+				e.OnDelivered(err)
+			}
+		}
+	}()
+	if cfg.actionLimiter != nil && !cfg.actionLimiter.allow(e.Action) {
+		dropped = true
+		return nil
+	}
+	if cfg.actorLimiter != nil && !cfg.actorLimiter.allow(e.Ctx.ActorID) {
+		dropped = true
+		return nil
+	}
+	if extraFunc != nil {
+		e.Extra = extraFunc()
+	}
+	if cfg.DeadlineRemaining && hasDeadline {
+		e.Extra = withDeadlineRemaining(e.Extra, deadline)
+	}
+	for _, hook := range cfg.BeforeSend {
+		if !hook(&e) {
+			dropped = true
+			return nil
+		}
+	}
+	if dedupe := cfg.dedupeKeys; dedupe != nil && e.DedupeKey != "" {
+		key := "quicklog:dedupe:" + e.DedupeKey
+		if !dedupe.Add(key, cfg.DedupeWindow) {
+			dropped = true
+			return nil
+		}
+		defer func() {
+			if err != nil {
+				if _, partial := err.(*PartialError); !partial {
+					dedupe.Remove(key)
+				}
+			}
+		}()
+	}
+	if afterSend := cfg.AfterSend; len(afterSend) > 0 {
+		defer func() {
+			for _, hook := range afterSend {
+				hook(e, err)
+			}
+		}()
+	}
+	projectID := cfg.ProjectID
+	if e.ProjectID < 0 {
+		return fmt.Errorf("'ProjectID' must be a positive number")
+	} else if e.ProjectID != 0 {
+		projectID = e.ProjectID
+	}
+	if projectID == 0 {
 		return fmt.Errorf("ProjectID must be set in Config options")
 	}
-	if config.ApiKey == "" {
-		return fmt.Errorf("ApiKey must be set in Config options")
+	if e.RetentionDays < 0 {
+		return fmt.Errorf("'RetentionDays' must not be negative")
 	}
-	if config.ApiURL == "" {
-		return fmt.Errorf("ApiURL must be set in Config options")
+	if e.Published.IsZero() {
+		e.Published = time.Now()
+	}
+	if cfg.MaxClockSkew > 0 && cfg.FuturePolicy != SkewPassThrough {
+		if now := time.Now(); e.Published.After(now.Add(cfg.MaxClockSkew)) {
+			if cfg.FuturePolicy == SkewReject {
+				return fmt.Errorf("'published' %v is more than %v in the future", e.Published, cfg.MaxClockSkew)
+			}
+			e.Published = now
+		}
+	}
+	if e.Ctx.SpanID != "" && e.Ctx.SpanID == e.Ctx.ParentSpanID {
+		return fmt.Errorf("Ctx ParentSpanID must differ from SpanID %q", e.Ctx.SpanID)
+	}
+	if err := checkControlChars(cfg, &e); err != nil {
+		return err
+	}
+	if cfg.RequireQualifiedIDs {
+		if err := checkQualifiedID("object", e.Object); err != nil {
+			return err
+		}
+		if err := checkQualifiedID("target", e.Target); err != nil {
+			return err
+		}
 	}
 
-	url := config.ApiURL + "/entries?api_key=" + config.ApiKey
+	extra, err := buildExtra(ctx, cfg, e)
+	if err != nil {
+		return err
+	}
 
 	body := entryBody{
-		ProjectID:    config.ProjectID,
-		Published:    published,
-		Source:       config.Source,
-		Actor:        traceCtx.ActorID,
-		Type:         action,
-		Object:       object,
-		Target:       target,
-		Context:      extra,
-		TraceID:      traceCtx.TraceID,
-		ParentSpanID: traceCtx.ParentSpanID,
-		SpanID:       traceCtx.SpanID,
-	}
-
-	content, err := json.Marshal(body)
+		ProjectID:     projectID,
+		Published:     &e.Published,
+		Level:         e.Level,
+		Source:        cfg.Source,
+		Actor:         actor(cfg, e.Ctx.ActorID),
+		Type:          e.Action,
+		Object:        e.Object,
+		Target:        e.Target,
+		Context:       extra,
+		TraceID:       e.Ctx.TraceID,
+		ParentSpanID:  e.Ctx.ParentSpanID,
+		SpanID:        e.Ctx.SpanID,
+		Links:         e.Links,
+		Events:        e.Events,
+		RetentionDays: e.RetentionDays,
+	}
+	if state := stateOf(e.Ctx.TraceID); state != nil {
+		body.Seq = atomic.AddUint64(&state.seq, 1)
+	}
+
+	if cfg.UseServerTime {
+		body.Published = nil
+	}
+
+	marshalStart := time.Now()
+	buf := getBuffer()
+	defer putBuffer(buf)
+	content, err := marshal(cfg, buf, body)
 	if err != nil {
 		return err
 	}
+	if cfg.ValidateSchema {
+		if err := validateEntry(content); err != nil {
+			return err
+		}
+	}
+	sendCtx := withTraceID(ctx, e.Ctx.TraceID)
+	if len(cfg.FieldNames) != 0 || cfg.Envelope != nil {
+		sendCtx = withPlainBody(sendCtx, content)
+	}
+	if len(cfg.FieldNames) != 0 {
+		if content, err = renameFields(content, cfg.FieldNames); err != nil {
+			return err
+		}
+	}
+	if cfg.Envelope != nil {
+		envBuf := getBuffer()
+		defer putBuffer(envBuf)
+		if content, err = marshal(cfg, envBuf, cfg.Envelope(json.RawMessage(content))); err != nil {
+			return err
+		}
+	}
 
-	resp, err := config.Client.Post(url, "application/json", bytes.NewReader(content))
-	defer resp.Body.Close()
+	sendStart := time.Now()
+	err = cfg.sink().SendEntry(sendCtx, content)
+	if cfg.OnTimings != nil {
+		cfg.OnTimings(e, Timings{Serialize: sendStart.Sub(marshalStart), Send: time.Since(sendStart), Size: len(content)})
+	}
+	delivered = true
+	if e.OnDelivered != nil {
+		e.OnDelivered(err)
+	}
 	if err != nil {
-		errBody, err2 := ioutil.ReadAll(resp.Body)
-		if len(errBody) != 0 && err2 == nil {
-			return fmt.Errorf("%v : BODY = %s", err.Error(), string(errBody))
-		} else {
-			return err
+		return err
+	}
+
+	if err := tagTrace(ctx, projectID, e.Ctx.TraceID, e.Tags...); err != nil {
+		return &PartialError{Err: err}
+	}
+	return nil
+}
+
+// PartialError is returned when an entry was logged but its tags were not all
+// added. Err is the tagging error. There is no way to remove an entry, so the
+// caller may retry the tags with TagTrace (tags are idempotent).
+type PartialError struct {
+	Err error
+}
+
+func (e *PartialError) Error() string {
+	return "entry logged but tagging failed: " + e.Err.Error()
+}
+
+func (e *PartialError) Unwrap() error {
+	return e.Err
+}
+
+/**
+ * Logs e and then tags its trace with e.Tags and tags. If the entry fails no
+ * tags are sent and its error is returned; if only tagging fails a
+ * *PartialError is returned. Quicklog and Log behave the same way.
+ * @param {context.Context} ctx
+ * @param {Entry} e
+ * @param {tags}
+ * @return error
+ */
+func LogWithTags(ctx context.Context, e Entry, tags ...string) error {
+	e.Tags = append(e.Tags[:len(e.Tags):len(e.Tags)], tags...)
+	return LogContext(ctx, e)
+}
+
+// actor returns the actor to send for actorID, hashed if Config.ActorHasher is set.
+func actor(cfg *settings, actorID string) string {
+	if cfg.ActorHasher == nil || actorID == "" {
+		return actorID
+	}
+	return cfg.ActorHasher(actorID)
+}
+
+// shouldSend reports whether an entry passes the filters that drop it without error.
+func shouldSend(cfg *settings, e Entry) bool {
+	if e.Level != 0 && e.Level < cfg.MinLevel {
+		return false
+	}
+	if cfg.Enabled != nil && !cfg.Enabled() {
+		return false
+	}
+	return true
+}
+
+// renameFields renames the top-level keys of a JSON object.
+func renameFields(content []byte, names map[string]string) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(content, &fields); err != nil {
+		return nil, err
+	}
+	renamed := make(map[string]json.RawMessage, len(fields))
+	for k, v := range fields {
+		if name, ok := names[k]; ok {
+			k = name
 		}
+		renamed[k] = v
 	}
+	return json.Marshal(renamed)
+}
 
-	err = TagTrace(traceCtx.TraceID, tags...)
-	return err
+// withDeadlineRemaining returns a copy of extra with "deadline_remaining_ms"
+// added, or extra itself if it already has that key.
+func withDeadlineRemaining(extra map[string]interface{}, deadline time.Time) map[string]interface{} {
+	if _, ok := extra["deadline_remaining_ms"]; ok {
+		return extra
+	}
+	withRemaining := make(map[string]interface{}, len(extra)+1)
+	for k, v := range extra {
+		withRemaining[k] = v
+	}
+	withRemaining["deadline_remaining_ms"] = time.Until(deadline).Milliseconds()
+	return withRemaining
+}
+
+// buildExtra returns the extra sent for an entry, without modifying the caller's map.
+func buildExtra(ctx context.Context, cfg *settings, e Entry) (map[string]interface{}, error) {
+	var fromContext map[string]interface{}
+	if cfg.ExtraFromContext != nil {
+		fromContext = cfg.ExtraFromContext(ctx)
+	}
+	extra, err := limitExtra(cfg, e.Extra)
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.RawBinary {
+		if encoded, changed := encodeBinary(extra); changed {
+			extra = encoded.(map[string]interface{})
+		}
+	}
+	if cfg.hostMetadata == nil && cfg.LargeValueStore == nil && len(fromContext) == 0 && cfg.allowKeys == nil {
+		return extra, nil
+	}
+	result := make(map[string]interface{}, len(extra)+len(fromContext)+1)
+	for k, v := range fromContext {
+		result[k] = v
+	}
+	for k, v := range extra {
+		result[k] = v
+	}
+	if cfg.hostMetadata != nil {
+		if _, ok := result[hostKey]; !ok {
+			result[hostKey] = cfg.hostMetadata
+		}
+	}
+	if cfg.allowKeys != nil {
+		for k := range result {
+			if !cfg.allowKeys[k] {
+				delete(result, k)
+				atomic.AddUint64(&strippedKeys, 1)
+			}
+		}
+	}
+	if cfg.LargeValueStore != nil {
+		if err := storeLargeValues(ctx, cfg, e.Ctx.SpanID, result); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+/**
+ * Returns how many extra keys have been removed because they weren't in Config.AllowKeys.
+ * @return uint64
+ */
+func StrippedKeys() uint64 {
+	return atomic.LoadUint64(&strippedKeys)
 }
 
 /**
@@ -134,51 +1071,69 @@ func Quicklog(published time.Time, action, object, target string, extra map[stri
  * @return {promise} axios.post()
  */
 func TagTrace(traceID string, tags ...string) error {
+	cfg := loadSettings()
+	return tagTrace(withSettings(context.Background(), cfg), cfg.ProjectID, traceID, tags...)
+}
+
+/**
+ * Same as TagTrace but for a project other than Config.ProjectID.
+ * @param {int} projectID (must be non-zero)
+ * @param {string} traceID
+ * @param {tags}
+ * @return error
+ */
+func TagTraceProject(projectID int, traceID string, tags ...string) error {
+	if projectID <= 0 {
+		return fmt.Errorf("'projectID' must be a positive number")
+	}
+	return tagTrace(context.Background(), projectID, traceID, tags...)
+}
+
+func tagTrace(ctx context.Context, projectID int, traceID string, tags ...string) error {
+	if isDisabled() {
+		return nil
+	}
 	if len(tags) == 0 {
 		return nil
 	}
-	if config.ProjectID == 0 {
+	cfg := settingsFrom(ctx)
+	if projectID == 0 {
 		return fmt.Errorf("ProjectId must be set in Config options")
 	}
-	if config.ApiKey == "" {
-		return fmt.Errorf("ApiKey must be set in Config options")
-	}
-	if config.ApiURL == "" {
-		return fmt.Errorf("ApiURL must be set in Config options")
-	}
 	if traceID == "" {
 		return fmt.Errorf("'traceID' must be a non-empty string")
 	}
 
-	url := config.ApiURL + "/tags?api_key=" + config.ApiKey
-
 	body := tagBody{
-		ProjectID: config.ProjectID,
+		ProjectID: projectID,
 		TraceID:   traceID,
 	}
 
 	emptyTag := false
+	sent := 0
 	for _, tag := range tags {
 		if tag == "" {
 			emptyTag = true
 			continue
 		}
+		key := ""
+		if cfg.sentTags != nil {
+			key = "quicklog:tag:" + strconv.Itoa(projectID) + ":" + traceID + ":" + tag
+			if cfg.sentTags.Has(key) {
+				continue
+			}
+		}
+		if cfg.MaxTagsPerTrace > 0 && sent == cfg.MaxTagsPerTrace {
+			return ErrTooManyTags
+		}
+		sent++
 
 		body.Tag = tag
-		content, err := json.Marshal(body)
-		if err != nil {
+		if err := sendTag(ctx, cfg, body); err != nil {
 			return err
 		}
-
-		resp, err := config.Client.Post(url, "application/json", bytes.NewReader(content))
-		defer resp.Body.Close()
-		if err != nil {
-			errBody, err2 := ioutil.ReadAll(resp.Body)
-			if len(errBody) != 0 && err2 == nil {
-				return fmt.Errorf("%v : BODY = %s", err.Error(), string(errBody))
-			} else {
-				return err
-			}
+		if cfg.sentTags != nil {
+			cfg.sentTags.Add(key, 0)
 		}
 	}
 	if emptyTag {
@@ -187,6 +1142,408 @@ func TagTrace(traceID string, tags ...string) error {
 	return nil
 }
 
+func sendTag(ctx context.Context, cfg *settings, body tagBody) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	content, err := marshal(cfg, buf, body)
+	if err != nil {
+		return err
+	}
+	return cfg.sink().SendTag(withTraceID(ctx, body.TraceID), content)
+}
+
+var bufferPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	// Don't keep unusually large buffers around.
+	if buf.Cap() > 64*1024 {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+// marshal encodes v into buf, returning buf's bytes without the encoder's
+// trailing newline. They are only valid until buf is returned to the pool.
+// A Config.Marshaler is used instead if set.
+func marshal(cfg *settings, buf *bytes.Buffer, v interface{}) ([]byte, error) {
+	if cfg.Marshaler != nil {
+		return cfg.Marshaler(v)
+	}
+	buf.Reset()
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// apiSink sends to a quicklog API. The zero value is the default Sink, using
+// the Config settings.
+type apiSink struct {
+	apiURL string
+	apiKey string
+}
+
+/**
+ * Returns a Sink sending to the quicklog API at apiURL, e.g. to send to a
+ * second backend with MultiSink. Requests use the configured Client and retries.
+ * @param {string} apiURL
+ * @param {string} apiKey
+ * @return Sink
+ */
+func APISink(apiURL, apiKey string) Sink {
+	return apiSink{apiURL: apiURL, apiKey: apiKey}
+}
+
+func (s apiSink) SendEntry(ctx context.Context, body []byte) error {
+	cfg := settingsFrom(ctx)
+	url, err := s.endpoint(cfg, cfg.EntriesURL, "/entries")
+	if err != nil {
+		return err
+	}
+	return post(ctx, url, nil, body, entryRetries(cfg))
+}
+
+func (s apiSink) SendTag(ctx context.Context, body []byte) error {
+	cfg := settingsFrom(ctx)
+	url, err := s.endpoint(cfg, cfg.TagsURL, "/tags")
+	if err != nil {
+		return err
+	}
+	return post(ctx, url, nil, body, tagRetries(cfg))
+}
+
+func entryRetries(cfg *settings) int {
+	if cfg.DisableEntryRetries {
+		return 0
+	}
+	return cfg.MaxRetries
+}
+
+func tagRetries(cfg *settings) int {
+	if cfg.DisableTagRetries {
+		return 0
+	}
+	return cfg.MaxRetries
+}
+
+/**
+ * Posts an entry body to url as the default Sink does, for Sinks that send
+ * somewhere else (e.g. otlp.Sink): with the configured Client, MaxInFlight,
+ * RequestSigner and OnRequest/OnResponse, retrying up to Config.MaxRetries
+ * times (unless DisableEntryRetries) with Config.Backoff, and waiting as long
+ * as a Retry-After header asks. Pass the ctx given to SendEntry, which
+ * carries the settings the entry was logged with.
+ * @param {context.Context} ctx
+ * @param {string} url
+ * @param {http.Header} header is added to the request (may be nil)
+ * @param {[]byte} body JSON
+ * @return error
+ */
+func PostEntry(ctx context.Context, url string, header http.Header, body []byte) error {
+	return post(ctx, url, header, body, entryRetries(settingsFrom(ctx)))
+}
+
+/**
+ * Same as PostEntry for a tag body, retried unless DisableTagRetries.
+ * @return error
+ */
+func PostTag(ctx context.Context, url string, header http.Header, body []byte) error {
+	return post(ctx, url, header, body, tagRetries(settingsFrom(ctx)))
+}
+
+// endpoint returns the URL to post to: path under the sink's API URL, or for
+// the default sink override if set or else path under Config.ApiURL.
+func (s apiSink) endpoint(cfg *settings, override, path string) (string, error) {
+	var url, key string
+	if s.apiURL != "" {
+		url, key = s.apiURL+path, s.apiKey
+		if key == "" {
+			return "", fmt.Errorf("'apiKey' must be a non-empty string")
+		}
+	} else {
+		if err := checkAPIConfig(cfg); err != nil {
+			return "", err
+		}
+		url, key = override, cfg.ApiKey
+		if url == "" {
+			url = cfg.ApiURL + path
+		}
+	}
+	sep := "?"
+	if strings.Contains(url, "?") {
+		sep = "&"
+	}
+	return url + sep + "api_key=" + key, nil
+}
+
+func checkAPIConfig(cfg *settings) error {
+	if cfg.ApiKey == "" {
+		return fmt.Errorf("ApiKey must be set in Config options")
+	}
+	if cfg.ApiURL == "" {
+		return fmt.Errorf("ApiURL must be set in Config options")
+	}
+	return nil
+}
+
+/**
+ * Opens a connection to the configured API ahead of the first entry, so it
+ * doesn't pay for DNS resolution and the TCP and TLS handshakes, e.g. at
+ * startup. It makes a HEAD request to ApiURL with the configured Client,
+ * whose Transport keeps the connection for reuse; any HTTP response counts as
+ * success. Does nothing if a Sink is configured or sending is disabled.
+ * @param {context.Context} ctx bounds the warm-up
+ * @return error if the API couldn't be reached
+ */
+func Warmup(ctx context.Context) error {
+	cfg := loadSettings()
+	if cfg.Sink != nil || isDisabled() {
+		return nil
+	}
+	if err := checkAPIConfig(cfg); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, cfg.ApiURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", userAgent(cfg))
+	resp, err := cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+func (cfg *settings) sink() Sink {
+	if cfg.Sink != nil {
+		return cfg.Sink
+	}
+	return apiSink{}
+}
+
+// post sends content, retrying up to retries times. Every attempt sends the
+// same already-marshaled bytes, so a retried entry keeps its trace and span IDs.
+// Each attempt reads them through a new bytes.Reader (which also gives the
+// request a GetBody for redirects), so content must be fully buffered: to send
+// a stream, read it into a []byte first rather than passing a reader along.
+func post(ctx context.Context, url string, header http.Header, content []byte, retries int) error {
+	for attempt := 0; ; attempt++ {
+		retry, wait, err := postOnce(ctx, url, header, content)
+		if err == nil || !retry || attempt >= retries {
+			return err
+		}
+		if backoff := retryBackoff(settingsFrom(ctx), attempt); wait < backoff {
+			wait = backoff
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return err
+		}
+		if !retrySleep(ctx, wait) {
+			return err
+		}
+	}
+}
+
+// retrySleep waits d before a retry, reporting false if ctx is done first.
+// It is replaced in tests.
+var retrySleep = func(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// postOnce makes a single attempt, returning whether a failure may be retried
+// and how long the server asked us to wait before doing so.
+func postOnce(ctx context.Context, url string, header http.Header, content []byte) (bool, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(content))
+	if err != nil {
+		return false, 0, err
+	}
+	cfg := settingsFrom(ctx)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent(cfg))
+	if cfg.RequestSigner != nil {
+		if err := cfg.RequestSigner(req, content); err != nil {
+			return false, 0, err
+		}
+	}
+
+	resp, respBody, err := do(ctx, req)
+	if err != nil {
+		return ctx.Err() == nil && err != ErrTooManyInFlight, 0, err
+	}
+	if resp.StatusCode < 300 {
+		return false, 0, nil
+	}
+
+	err = statusError(resp, respBody)
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+		return true, retryAfter(resp.Header.Get("Retry-After")), err
+	case resp.StatusCode >= 500:
+		return true, 0, err
+	}
+	return false, 0, err
+}
+
+// detachedContext keeps the values of a context but not its cancellation.
+type detachedContext struct{ context.Context }
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func detach(ctx context.Context) context.Context {
+	return detachedContext{ctx}
+}
+
+func userAgent(cfg *settings) string {
+	if cfg.UserAgent == "" {
+		return "quicklog-go/" + Version
+	}
+	return "quicklog-go/" + Version + " " + cfg.UserAgent
+}
+
+type clientKey struct{}
+
+// withTimeout makes requests made with the returned context use timeout in place
+// of the configured client's Timeout.
+func withTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	base := settingsFrom(ctx).Client
+	if base == nil {
+		// Not configured yet; the entry will fail validation.
+		base = http.DefaultClient
+	}
+	client := *base
+	client.Timeout = timeout
+	return context.WithValue(ctx, clientKey{}, &client)
+}
+
+func httpClient(ctx context.Context) *http.Client {
+	if client, ok := ctx.Value(clientKey{}).(*http.Client); ok {
+		return client
+	}
+	if client := settingsFrom(ctx).Client; client != nil {
+		return client
+	}
+	// Before Configure, e.g. PostEntry called directly.
+	return unconfiguredClient
+}
+
+var unconfiguredClient = &http.Client{Timeout: 3 * time.Second}
+
+// do sends req, calling the OnRequest and OnResponse hooks, and returns the
+// response with its body already read (resp.Body is left readable for hooks).
+func do(ctx context.Context, req *http.Request) (*http.Response, []byte, error) {
+	cfg := settingsFrom(ctx)
+	release, err := acquireInFlight(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer release()
+	if cfg.OnRequest != nil {
+		cfg.OnRequest(req)
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	client := httpClient(ctx)
+	adaptive := cfg.AdaptiveTimeout
+	if _, perEntry := ctx.Value(clientKey{}).(*http.Client); adaptive != nil && !perEntry {
+		copied := *client
+		copied.Timeout = adaptive.timeout(client.Timeout)
+		client = &copied
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if adaptive != nil {
+		adaptive.observe(time.Since(start))
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.OnResponse != nil {
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		cfg.OnResponse(resp, time.Since(start))
+	}
+	return resp, body, nil
+}
+
+// acquireInFlight takes one of the Config.MaxInFlight slots, returning the
+// function that gives it back.
+func acquireInFlight(ctx context.Context, cfg *settings) (func(), error) {
+	slots := cfg.inFlightSlots
+	if slots == nil {
+		return func() {}, nil
+	}
+	if cfg.FailFast {
+		select {
+		case slots <- struct{}{}:
+		default:
+			return nil, ErrTooManyInFlight
+		}
+	} else {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return func() { <-slots }, nil
+}
+
+func statusError(resp *http.Response, body []byte) error {
+	if len(body) != 0 {
+		return fmt.Errorf("%s : BODY = %s", resp.Status, string(body))
+	}
+	return fmt.Errorf("%s", resp.Status)
+}
+
+func retryBackoff(cfg *settings, attempt int) time.Duration {
+	if cfg.Backoff != nil {
+		return cfg.Backoff.NextDelay(attempt)
+	}
+	return ExponentialBackoff{Initial: cfg.RetryDelay}.NextDelay(attempt)
+}
+
+// retryAfter parses a Retry-After header in either delta-seconds or HTTP-date form.
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
 /**
  * Creates a Ctx containing 'ActorID', 'TraceID', 'ParentSpanID', and a newly generated 'SpanID'.
  * If called with an empty 'traceID', it is set to the new SpanID, and ParentSpanID will be empty.
@@ -196,6 +1553,9 @@ func TagTrace(traceID string, tags ...string) error {
  */
 func TraceCtx(actorID, traceID, parentSpanID string) Ctx {
 	spanID := GenerateID()
+	for spanID == parentSpanID {
+		spanID = GenerateID()
+	}
 	if traceID == "" {
 		traceID = spanID
 		parentSpanID = ""
@@ -208,9 +1568,63 @@ func TraceCtx(actorID, traceID, parentSpanID string) Ctx {
 	}
 }
 
+/**
+ * Creates a Ctx for a new span in a known trace whose parent span isn't known,
+ * e.g. when resuming work from a durable queue. ParentSpanID is left empty
+ * rather than guessed. An empty traceID starts a new trace, as with TraceCtx.
+ * @param {string} actorID
+ * @param {string} traceID
+ * @return Ctx
+ */
+func TraceCtxFromTrace(actorID, traceID string) Ctx {
+	return TraceCtx(actorID, traceID, "")
+}
+
+/**
+ * Creates a Ctx from IDs generated elsewhere, e.g. by an OpenTelemetry SDK, using
+ * them verbatim. IDs must be lowercase hex: traceID 16 or 32 digits, spanID and
+ * (if not empty) parentSpanID 16 digits.
+ * @param {string} traceID
+ * @param {string} spanID
+ * @param {string} parentSpanID
+ * @param {string} actorID
+ * @return Ctx, error
+ */
+func CtxFromIDs(traceID, spanID, parentSpanID, actorID string) (Ctx, error) {
+	if !isHexID(traceID, 16) && !isHexID(traceID, 32) {
+		return Ctx{}, fmt.Errorf("'traceID' must be 16 or 32 lowercase hex digits, got %q", traceID)
+	}
+	if !isHexID(spanID, 16) {
+		return Ctx{}, fmt.Errorf("'spanID' must be 16 lowercase hex digits, got %q", spanID)
+	}
+	if parentSpanID != "" && !isHexID(parentSpanID, 16) {
+		return Ctx{}, fmt.Errorf("'parentSpanID' must be empty or 16 lowercase hex digits, got %q", parentSpanID)
+	}
+	if parentSpanID == spanID {
+		return Ctx{}, fmt.Errorf("'parentSpanID' must differ from 'spanID'")
+	}
+	return Ctx{
+		ActorID:      actorID,
+		TraceID:      traceID,
+		ParentSpanID: parentSpanID,
+		SpanID:       spanID,
+	}, nil
+}
+
+/**
+ * Generates a random 16 hex digit ID from crypto/rand. If that fails, a
+ * per-process math/rand source is used, so an ID is always returned; the first
+ * failure is logged.
+ * @return string
+ */
 func GenerateID() string {
 	src := make([]byte, 8)
-	binary.LittleEndian.PutUint64(src, rand.Uint64())
+	if _, err := io.ReadFull(randReader, src); err != nil {
+		fallbackLogged.Do(func() { logf("quicklog: crypto/rand failed, using math/rand for IDs: %v", err) })
+		fallbackRandMu.Lock()
+		binary.LittleEndian.PutUint64(src, fallbackRand.Uint64())
+		fallbackRandMu.Unlock()
+	}
 	dst := make([]byte, hex.EncodedLen(len(src)))
 
 	hex.Encode(dst, src)
@@ -0,0 +1,1327 @@
+package quicklog
+
+import (
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testServer is a quicklog API recording the entries and tags posted to it.
+// Handler, if set, replaces the default 200 response.
+type testServer struct {
+	*httptest.Server
+	Handler func(w http.ResponseWriter, r *http.Request, body []byte)
+
+	mu       sync.Mutex
+	requests []*http.Request
+	entries  []map[string]interface{}
+	tags     []map[string]interface{}
+}
+
+func newTestServer(t *testing.T) *testServer {
+	s := &testServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var fields map[string]interface{}
+		json.Unmarshal(body, &fields)
+		s.mu.Lock()
+		s.requests = append(s.requests, r)
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/entries"):
+			s.entries = append(s.entries, fields)
+		case strings.HasPrefix(r.URL.Path, "/tags"):
+			s.tags = append(s.tags, fields)
+		}
+		handler := s.Handler
+		s.mu.Unlock()
+		if handler != nil {
+			handler(w, r, body)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testServer) Entries() []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]map[string]interface{}(nil), s.entries...)
+}
+
+func (s *testServer) Tags() []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]map[string]interface{}(nil), s.tags...)
+}
+
+func (s *testServer) Requests() []*http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*http.Request(nil), s.requests...)
+}
+
+// configureTest configures c, with ProjectID, ApiKey and ApiURL defaulting
+// to a test project on s, and restores an empty Config when the test ends.
+func configureTest(t *testing.T, s *testServer, c Config) {
+	t.Helper()
+	if c.ProjectID == 0 {
+		c.ProjectID = 12345
+	}
+	if c.ApiKey == "" {
+		c.ApiKey = "test-key"
+	}
+	if c.ApiURL == "" && s != nil {
+		c.ApiURL = s.URL
+	}
+	if err := Configure(c); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Configure(Config{}) })
+}
+
+// waitFor polls cond until it is true, failing the test after a few seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// safeBuffer is a bytes.Buffer for an ErrorLog written from other goroutines.
+type safeBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *safeBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *safeBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestQuicklogSendsEntryAndTags(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{Source: "test"})
+	traceCtx := TraceCtx("user:1", "", "")
+
+	err := Quicklog(time.Now(), "a-type", "object:1", "target:2", map[string]interface{}{"key": "value"}, traceCtx, "name:value", "value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := s.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	e := entries[0]
+	if e["type"] != "a-type" || e["object"] != "object:1" || e["target"] != "target:2" || e["source"] != "test" {
+		t.Errorf("unexpected entry %v", e)
+	}
+	if e["trace_id"] != traceCtx.TraceID || e["span_id"] != traceCtx.SpanID || e["actor"] != "user:1" {
+		t.Errorf("entry has wrong trace fields %v", e)
+	}
+	if len(s.Tags()) != 2 {
+		t.Errorf("got %d tags, want 2", len(s.Tags()))
+	}
+}
+
+func TestLogRequiresProjectID(t *testing.T) {
+	Configure(Config{})
+	if err := Log(Entry{Action: "a", Ctx: TraceCtx("", "", "")}); err == nil || !strings.Contains(err.Error(), "ProjectID") {
+		t.Errorf("got %v, want a ProjectID error", err)
+	}
+}
+
+func TestTimeoutBeforeConfigure(t *testing.T) {
+	// As before any Configure call.
+	current.Store(&settings{})
+	t.Cleanup(func() { Configure(Config{}) })
+	err := Log(Entry{Action: "a", Timeout: time.Second, Ctx: TraceCtx("", "", "")})
+	if err == nil || !strings.Contains(err.Error(), "ProjectID") {
+		t.Errorf("got %v, want a ProjectID error", err)
+	}
+}
+
+func TestQuicklogWithTimeout(t *testing.T) {
+	s := newTestServer(t)
+	release := make(chan struct{})
+	defer close(release)
+	s.Handler = func(w http.ResponseWriter, r *http.Request, body []byte) {
+		select {
+		case <-release:
+		case <-time.After(2 * time.Second):
+		}
+	}
+	configureTest(t, s, Config{})
+
+	start := time.Now()
+	err := QuicklogWithTimeout(50*time.Millisecond, time.Now(), "slow", "", "", nil, TraceCtx("", "", ""))
+	if err == nil {
+		t.Fatal("expected a timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("took %v, the per-entry timeout wasn't used", elapsed)
+	}
+}
+
+func TestWarmup(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{})
+	if err := Warmup(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if reqs := s.Requests(); len(reqs) != 1 || reqs[0].Method != http.MethodHead {
+		t.Errorf("got %d requests, want one HEAD", len(reqs))
+	}
+
+	Disable()
+	defer Enable()
+	if err := Warmup(context.Background()); err != nil {
+		t.Errorf("disabled warm-up returned %v", err)
+	}
+	if len(s.Requests()) != 1 {
+		t.Error("warm-up made a request while disabled")
+	}
+}
+
+func TestChildrenShareSeq(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{})
+	root, err := CtxFromIDs("0123456789abcdef", "1111111111111111", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []Ctx{root, root.Child(), root.Child(), root.Child().Child()} {
+		if err := Log(Entry{Action: "a", Ctx: c}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, e := range s.Entries() {
+		if e["seq"] != float64(i+1) {
+			t.Errorf("entry %d has seq %v, want %d", i, e["seq"], i+1)
+		}
+	}
+
+	// Ctx values made separately for the trace continue its numbering.
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("traceparent", "00-00000000000000000123456789abcdef-1111111111111111-01")
+	siblings := []Ctx{
+		TraceCtx("", root.TraceID, root.ParentSpanID),
+		TraceCtxFromTrace("", root.TraceID),
+		CtxFromRequest(r, nil),
+		{TraceID: root.TraceID, SpanID: "2222222222222222"},
+	}
+	for _, c := range siblings {
+		if err := Log(Entry{Action: "b", Ctx: c}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := LogToTraces(context.Background(), Entry{Action: "c"}, root.TraceID); err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range s.Entries()[4:] {
+		if e["seq"] != float64(i+5) {
+			t.Errorf("sibling entry %d has seq %v, want %d", i, e["seq"], i+5)
+		}
+	}
+}
+
+func TestDedupeSkipsAfterSend(t *testing.T) {
+	s := newTestServer(t)
+	var mu sync.Mutex
+	var after []error
+	configureTest(t, s, Config{
+		DedupeWindow: time.Minute,
+		AfterSend: []func(Entry, error){func(e Entry, err error) {
+			mu.Lock()
+			after = append(after, err)
+			mu.Unlock()
+		}},
+	})
+	for i := 0; i < 3; i++ {
+		if err := Log(Entry{Action: "a", DedupeKey: "once", Ctx: TraceCtx("", "", "")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(s.Entries()) != 1 {
+		t.Errorf("sent %d entries, want 1", len(s.Entries()))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(after) != 1 || after[0] != nil {
+		t.Errorf("AfterSend ran with %v, want once with nil", after)
+	}
+}
+
+func TestDedupeWindowExpires(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	cacheNow = func() time.Time { return now }
+	defer func() { cacheNow = time.Now }()
+	s := newTestServer(t)
+	configureTest(t, s, Config{DedupeWindow: time.Minute})
+	log := func() {
+		if err := Log(Entry{Action: "a", DedupeKey: "order:1", Ctx: TraceCtx("", "", "")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	log()
+	now = now.Add(59 * time.Second)
+	log()
+	if len(s.Entries()) != 1 {
+		t.Fatalf("sent %d entries within the window, want 1", len(s.Entries()))
+	}
+	now = now.Add(2 * time.Second)
+	log()
+	if len(s.Entries()) != 2 {
+		t.Errorf("sent %d entries, want the duplicate sent again after the window", len(s.Entries()))
+	}
+}
+
+func TestProjectIDOverride(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{})
+	traceCtx := TraceCtx("", "", "")
+	if err := Log(Entry{Action: "a", ProjectID: 777, Ctx: traceCtx, Tags: []string{"t"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := TagTraceProject(888, traceCtx.TraceID, "u"); err != nil {
+		t.Fatal(err)
+	}
+	if e := s.Entries(); len(e) != 1 || e[0]["project_id"] != float64(777) {
+		t.Errorf("entry sent to %v, want project 777", e)
+	}
+	tags := s.Tags()
+	if len(tags) != 2 || tags[0]["project_id"] != float64(777) || tags[1]["project_id"] != float64(888) {
+		t.Errorf("tags sent to %v, want projects 777 and 888", tags)
+	}
+
+	if err := Log(Entry{Action: "a", ProjectID: -1, Ctx: traceCtx}); err == nil {
+		t.Error("a negative ProjectID was accepted")
+	}
+	if err := TagTraceProject(0, traceCtx.TraceID, "u"); err == nil {
+		t.Error("TagTraceProject accepted project 0")
+	}
+}
+
+func TestDetachContext(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{})
+	type key struct{}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "kept"))
+	cancel()
+	if err := LogContext(ctx, Entry{Action: "a", Ctx: TraceCtx("", "", "")}); err == nil {
+		t.Error("an entry was sent with a cancelled context")
+	}
+
+	var seen interface{}
+	configureTest(t, s, Config{
+		DetachContext:    true,
+		ExtraFromContext: func(ctx context.Context) map[string]interface{} { seen = ctx.Value(key{}); return nil },
+	})
+	if err := LogContext(ctx, Entry{Action: "a", Ctx: TraceCtx("", "", "")}); err != nil {
+		t.Errorf("DetachContext didn't ignore the cancellation: %v", err)
+	}
+	if seen != "kept" {
+		t.Errorf("got context value %v, want it kept", seen)
+	}
+	if len(s.Entries()) != 1 {
+		t.Errorf("got %d entries, want 1", len(s.Entries()))
+	}
+}
+
+func TestExtraFromContext(t *testing.T) {
+	s := newTestServer(t)
+	type key struct{}
+	configureTest(t, s, Config{ExtraFromContext: func(ctx context.Context) map[string]interface{} {
+		return map[string]interface{}{"tenant": ctx.Value(key{}), "shared": "context"}
+	}})
+	ctx := context.WithValue(context.Background(), key{}, "acme")
+	extra := map[string]interface{}{"shared": "entry"}
+	if err := LogContext(ctx, Entry{Action: "a", Extra: extra, Ctx: TraceCtx("", "", "")}); err != nil {
+		t.Fatal(err)
+	}
+	context := s.Entries()[0]["context"].(map[string]interface{})
+	if context["tenant"] != "acme" || context["shared"] != "entry" {
+		t.Errorf("got context %v", context)
+	}
+	if len(extra) != 1 {
+		t.Errorf("the caller's extra was modified: %v", extra)
+	}
+}
+
+func TestMaxTagsPerTrace(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{MaxTagsPerTrace: 2})
+	traceCtx := TraceCtx("", "", "")
+	if err := TagTrace(traceCtx.TraceID, "a", "b", "c"); err != ErrTooManyTags {
+		t.Errorf("got %v, want ErrTooManyTags", err)
+	}
+	if len(s.Tags()) != 2 {
+		t.Errorf("sent %d tags, want the first 2", len(s.Tags()))
+	}
+
+	err := Quicklog(time.Now(), "a", "", "", nil, traceCtx, "a", "b", "c")
+	var partial *PartialError
+	if !errors.As(err, &partial) || !errors.Is(err, ErrTooManyTags) {
+		t.Errorf("got %v, want a PartialError for ErrTooManyTags", err)
+	}
+	if len(s.Entries()) != 1 {
+		t.Errorf("got %d entries, want 1", len(s.Entries()))
+	}
+}
+
+func TestUseServerTime(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{})
+	if err := Log(Entry{Published: time.Now(), Action: "a", Ctx: TraceCtx("", "", "")}); err != nil {
+		t.Fatal(err)
+	}
+	configureTest(t, s, Config{UseServerTime: true})
+	if err := Log(Entry{Published: time.Now(), Action: "a", Ctx: TraceCtx("", "", "")}); err != nil {
+		t.Fatal(err)
+	}
+	entries := s.Entries()
+	if _, ok := entries[0]["published"]; !ok {
+		t.Error("published was left out by default")
+	}
+	if _, ok := entries[1]["published"]; ok {
+		t.Error("published was sent with UseServerTime")
+	}
+}
+
+func TestLink(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{})
+	e := Entry{Action: "a", Ctx: TraceCtx("", "", "")}.Link("trace1", "").Link("trace2", "span2")
+	first, second := e.Link("trace3", ""), e.Link("trace4", "")
+	if len(e.Links) != 2 || e.Links[1] != "trace2:span2" || first.Links[2] != "trace3" || second.Links[2] != "trace4" {
+		t.Errorf("Link changed the entry it was called on: %v, %v, %v", e.Links, first.Links, second.Links)
+	}
+	if err := Log(e); err != nil {
+		t.Fatal(err)
+	}
+	links := s.Entries()[0]["links"].([]interface{})
+	if len(links) != 2 || links[0] != "trace1" || links[1] != "trace2:span2" {
+		t.Errorf("got links %v", links)
+	}
+}
+
+func TestSeparateEndpoints(t *testing.T) {
+	s := newTestServer(t)
+	other := newTestServer(t)
+	configureTest(t, s, Config{EntriesURL: other.URL + "/ingest?v=1", TagsURL: other.URL + "/tags"})
+	if err := Log(Entry{Action: "a", Ctx: TraceCtx("", "", ""), Tags: []string{"t"}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Requests()) != 0 {
+		t.Errorf("sent %d requests to ApiURL", len(s.Requests()))
+	}
+	reqs := other.Requests()
+	if len(reqs) != 2 {
+		t.Fatalf("got %d requests, want 2", len(reqs))
+	}
+	if reqs[0].URL.Path != "/ingest" || reqs[0].URL.Query().Get("v") != "1" || reqs[0].URL.Query().Get("api_key") != "test-key" {
+		t.Errorf("entry sent to %v", reqs[0].URL)
+	}
+	if reqs[1].URL.Path != "/tags" || reqs[1].URL.Query().Get("api_key") != "test-key" {
+		t.Errorf("tag sent to %v", reqs[1].URL)
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{})
+	if err := Log(Entry{Action: "a", Ctx: TraceCtx("", "", "")}); err != nil {
+		t.Fatal(err)
+	}
+	configureTest(t, s, Config{UserAgent: "myservice/1.2.3"})
+	if err := Log(Entry{Action: "a", Ctx: TraceCtx("", "", "")}); err != nil {
+		t.Fatal(err)
+	}
+	reqs := s.Requests()
+	if ua := reqs[0].Header.Get("User-Agent"); ua != "quicklog-go/"+Version {
+		t.Errorf("got User-Agent %q", ua)
+	}
+	if ua := reqs[1].Header.Get("User-Agent"); ua != "quicklog-go/"+Version+" myservice/1.2.3" {
+		t.Errorf("got User-Agent %q", ua)
+	}
+}
+
+func TestAllowKeys(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{AllowKeys: []string{"kept"}, HostMetadata: true})
+	before := StrippedKeys()
+	extra := map[string]interface{}{"kept": 1, "secret": "x"}
+	if err := Quicklog(time.Now(), "a", "", "", extra, TraceCtx("", "", "")); err != nil {
+		t.Fatal(err)
+	}
+	context := s.Entries()[0]["context"].(map[string]interface{})
+	if len(context) != 1 || context["kept"] != float64(1) {
+		t.Errorf("got context %v, want only kept", context)
+	}
+	if stripped := StrippedKeys() - before; stripped != 2 {
+		t.Errorf("StrippedKeys grew by %d, want 2 (secret and _host)", stripped)
+	}
+	if len(extra) != 2 {
+		t.Errorf("the caller's extra was modified: %v", extra)
+	}
+}
+
+func TestFieldNames(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{FieldNames: map[string]string{"type": "event_type", "context": "ctx"}})
+	if err := Quicklog(time.Now(), "a", "", "", map[string]interface{}{"k": "v"}, TraceCtx("", "", "")); err != nil {
+		t.Fatal(err)
+	}
+	e := s.Entries()[0]
+	if e["event_type"] != "a" || e["type"] != nil || e["context"] != nil {
+		t.Errorf("got %v", e)
+	}
+	if ctx, ok := e["ctx"].(map[string]interface{}); !ok || ctx["k"] != "v" {
+		t.Errorf("got ctx %v", e["ctx"])
+	}
+}
+
+// countingReader fills each read with one byte value, incremented per read.
+type countingReader struct{ next byte }
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = r.next
+	}
+	r.next++
+	return len(p), nil
+}
+
+func TestSpanIsNotItsOwnParent(t *testing.T) {
+	randReader = &countingReader{}
+	defer func() { randReader = crand.Reader }()
+	c := TraceCtx("", "0123456789abcdef", "0000000000000000")
+	if c.SpanID == c.ParentSpanID {
+		t.Errorf("TraceCtx generated the parent's span ID %q", c.SpanID)
+	}
+
+	s := newTestServer(t)
+	configureTest(t, s, Config{})
+	self := Ctx{TraceID: "0123456789abcdef", SpanID: "1111111111111111", ParentSpanID: "1111111111111111"}
+	if err := Log(Entry{Action: "a", Ctx: self}); err == nil {
+		t.Error("an entry whose span is its own parent was sent")
+	}
+}
+
+func TestEnabledAndLogFunc(t *testing.T) {
+	s := newTestServer(t)
+	enabled := false
+	configureTest(t, s, Config{Enabled: func() bool { return enabled }})
+	calls := 0
+	extraFunc := func() map[string]interface{} { calls++; return map[string]interface{}{"k": "v"} }
+	if err := LogFunc(TraceCtx("", "", ""), "a", "", "", extraFunc, "t"); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 0 || len(s.Requests()) != 0 {
+		t.Errorf("a disabled entry called extraFunc %d times and sent %d requests", calls, len(s.Requests()))
+	}
+	enabled = true
+	if err := LogFunc(TraceCtx("", "", ""), "a", "", "", extraFunc); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 || len(s.Entries()) != 1 || s.Entries()[0]["context"].(map[string]interface{})["k"] != "v" {
+		t.Errorf("got %d calls and entries %v", calls, s.Entries())
+	}
+}
+
+func TestActorHasher(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{ActorHasher: func(id string) string { return "hashed-" + id }})
+	traceCtx := TraceCtx("user:1", "", "")
+	for _, c := range []Ctx{traceCtx, TraceCtx("", "", "")} {
+		if err := Log(Entry{Action: "a", Ctx: c}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries := s.Entries()
+	if entries[0]["actor"] != "hashed-user:1" || traceCtx.ActorID != "user:1" {
+		t.Errorf("got actor %v, Ctx actor %q", entries[0]["actor"], traceCtx.ActorID)
+	}
+	if entries[1]["actor"] != nil && entries[1]["actor"] != "" {
+		t.Errorf("an empty actor was hashed to %v", entries[1]["actor"])
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) { return 0, errors.New("no entropy") }
+
+func TestGenerateIDFallsBack(t *testing.T) {
+	var logged bytes.Buffer
+	configureTest(t, nil, Config{ErrorLog: log.New(&logged, "", 0)})
+	randReader = failingReader{}
+	fallbackLogged = sync.Once{}
+	defer func() { randReader = crand.Reader }()
+	a, b := GenerateID(), GenerateID()
+	GenerateID()
+	if len(a) != 16 || !isHexID(a, 16) || a == b {
+		t.Errorf("got IDs %q and %q", a, b)
+	}
+	if n := strings.Count(logged.String(), "no entropy"); n != 1 {
+		t.Errorf("the failure was logged %d times, want once: %q", n, logged.String())
+	}
+}
+
+func TestRequestHooks(t *testing.T) {
+	s := newTestServer(t)
+	s.Handler = func(w http.ResponseWriter, r *http.Request, body []byte) { w.Write([]byte("accepted")) }
+	var requestBody, responseBody []byte
+	var status int
+	configureTest(t, s, Config{
+		OnRequest: func(req *http.Request) {
+			body, _ := req.GetBody()
+			requestBody, _ = ioutil.ReadAll(body)
+		},
+		OnResponse: func(resp *http.Response, elapsed time.Duration) {
+			status = resp.StatusCode
+			responseBody, _ = ioutil.ReadAll(resp.Body)
+		},
+	})
+	if err := Log(Entry{Action: "a", Ctx: TraceCtx("", "", "")}); err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(requestBody, &fields); err != nil || fields["type"] != "a" {
+		t.Errorf("OnRequest read %q", requestBody)
+	}
+	if status != http.StatusOK || string(responseBody) != "accepted" {
+		t.Errorf("OnResponse got %d %q", status, responseBody)
+	}
+}
+
+func TestOnRequestMayReadTheBody(t *testing.T) {
+	s := newTestServer(t)
+	var dumped []byte
+	configureTest(t, s, Config{OnRequest: func(req *http.Request) { dumped, _ = ioutil.ReadAll(req.Body) }})
+	if err := Log(Entry{Action: "a", Ctx: TraceCtx("", "", "")}); err != nil {
+		t.Fatal(err)
+	}
+	if entries := s.Entries(); len(entries) != 1 || entries[0]["type"] != "a" || len(dumped) == 0 {
+		t.Errorf("got entries %v after OnRequest read %q", entries, dumped)
+	}
+}
+
+func TestTLSOptions(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	log := func() error { return Log(Entry{Action: "a", Ctx: TraceCtx("", "", "")}) }
+
+	configureTest(t, nil, Config{ApiURL: server.URL})
+	if err := log(); err == nil {
+		t.Error("an untrusted certificate was accepted")
+	}
+	configureTest(t, nil, Config{ApiURL: server.URL, RootCAFile: caFile})
+	if err := log(); err != nil {
+		t.Errorf("RootCAFile wasn't trusted: %v", err)
+	}
+	configureTest(t, nil, Config{ApiURL: server.URL, InsecureSkipVerify: true})
+	if err := log(); err != nil {
+		t.Errorf("InsecureSkipVerify didn't skip verification: %v", err)
+	}
+	if err := Configure(Config{RootCAFile: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+		t.Error("Configure accepted a missing RootCAFile")
+	}
+}
+
+func TestAddEvent(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{})
+	e := Entry{Action: "a", Ctx: TraceCtx("", "", "")}.AddEvent("started", nil)
+	withAttrs := e.AddEvent("retried", map[string]interface{}{"attempt": 2})
+	if len(e.Events) != 1 || len(withAttrs.Events) != 2 {
+		t.Errorf("AddEvent changed the entry it was called on: %v", e.Events)
+	}
+	if err := Log(withAttrs); err != nil {
+		t.Fatal(err)
+	}
+	events := s.Entries()[0]["events"].([]interface{})
+	first, second := events[0].(map[string]interface{}), events[1].(map[string]interface{})
+	if first["name"] != "started" || first["time"] == "" || first["attributes"] != nil {
+		t.Errorf("got event %v", first)
+	}
+	if second["name"] != "retried" || second["attributes"].(map[string]interface{})["attempt"] != float64(2) {
+		t.Errorf("got event %v", second)
+	}
+}
+
+func TestTraceCtxFromTrace(t *testing.T) {
+	c := TraceCtxFromTrace("user:1", "0123456789abcdef")
+	if c.TraceID != "0123456789abcdef" || c.ParentSpanID != "" || c.SpanID == "" || c.ActorID != "user:1" {
+		t.Errorf("got %+v", c)
+	}
+	if root := TraceCtxFromTrace("", ""); root.TraceID != root.SpanID {
+		t.Errorf("an empty trace ID gave %+v, want a new trace", root)
+	}
+}
+
+func TestRetentionDays(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{})
+	if err := Log(Entry{Action: "a", RetentionDays: 30, Ctx: TraceCtx("", "", "")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Log(Entry{Action: "a", Ctx: TraceCtx("", "", "")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Log(Entry{Action: "a", RetentionDays: -1, Ctx: TraceCtx("", "", "")}); err == nil {
+		t.Error("a negative RetentionDays was accepted")
+	}
+	entries := s.Entries()
+	if len(entries) != 2 || entries[0]["retention_days"] != float64(30) || entries[1]["retention_days"] != nil {
+		t.Errorf("got %v", entries)
+	}
+}
+
+func TestFuturePolicy(t *testing.T) {
+	s := newTestServer(t)
+	future := time.Now().Add(time.Hour)
+	for _, policy := range []SkewPolicy{SkewPassThrough, SkewClamp, SkewReject} {
+		configureTest(t, s, Config{MaxClockSkew: time.Minute, FuturePolicy: policy})
+		err := Log(Entry{Published: future, Action: "a", Ctx: TraceCtx("", "", "")})
+		if (err != nil) != (policy == SkewReject) {
+			t.Errorf("policy %d returned %v", policy, err)
+		}
+	}
+	entries := s.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	passed, _ := time.Parse(time.RFC3339Nano, entries[0]["published"].(string))
+	clamped, _ := time.Parse(time.RFC3339Nano, entries[1]["published"].(string))
+	if !passed.Equal(future) {
+		t.Errorf("SkewPassThrough sent %v, want %v", passed, future)
+	}
+	if clamped.After(time.Now()) {
+		t.Errorf("SkewClamp sent %v, in the future", clamped)
+	}
+}
+
+// recordingSink keeps a copy of each entry body it is sent.
+type recordingSink struct {
+	mu      sync.Mutex
+	entries [][]byte
+}
+
+func (s *recordingSink) SendEntry(ctx context.Context, body []byte) error {
+	s.mu.Lock()
+	s.entries = append(s.entries, append([]byte(nil), body...))
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *recordingSink) SendTag(ctx context.Context, body []byte) error { return nil }
+
+func (s *recordingSink) Entries() [][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]byte(nil), s.entries...)
+}
+
+func TestPooledBuffersMarshalLikeEncodingJSON(t *testing.T) {
+	sink := &recordingSink{}
+	configureTest(t, nil, Config{Sink: sink})
+	long := strings.Repeat("x", 10000)
+	for _, object := range []string{long, "<short & sweet>", ""} {
+		if err := Log(Entry{Action: "a", Object: object, Ctx: TraceCtx("", "", "")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, body := range sink.entries {
+		var e entryBody
+		if err := json.Unmarshal(body, &e); err != nil {
+			t.Fatalf("entry %d: %v in %q", i, err, body)
+		}
+		want, _ := json.Marshal(e)
+		if string(body) != string(want) {
+			t.Errorf("entry %d: got %s, want %s", i, body, want)
+		}
+	}
+}
+
+type nopSink struct{}
+
+func (nopSink) SendEntry(ctx context.Context, body []byte) error { return nil }
+func (nopSink) SendTag(ctx context.Context, body []byte) error   { return nil }
+
+func BenchmarkLog(b *testing.B) {
+	Configure(Config{ProjectID: 12345, Sink: nopSink{}})
+	defer Configure(Config{})
+	traceCtx := TraceCtx("user:1", "", "")
+	extra := map[string]interface{}{"key": "value", "n": 1}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := Log(Entry{Action: "a-type", Object: "object:1", Extra: extra, Ctx: traceCtx}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCtxFromIDs(t *testing.T) {
+	c, err := CtxFromIDs("fedcba98765432100123456789abcdef", "1111111111111111", "2222222222222222", "user:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.TraceID != "fedcba98765432100123456789abcdef" || c.SpanID != "1111111111111111" || c.ParentSpanID != "2222222222222222" || c.ActorID != "user:1" {
+		t.Errorf("got %+v", c)
+	}
+	for _, ids := range [][3]string{
+		{"0123456789ABCDEF", "1111111111111111", ""},
+		{"0123456789abcde", "1111111111111111", ""},
+		{"0123456789abcdef", "111111111111111g", ""},
+		{"0123456789abcdef", "1111111111111111", "22"},
+		{"0123456789abcdef", "1111111111111111", "1111111111111111"},
+	} {
+		if _, err := CtxFromIDs(ids[0], ids[1], ids[2], ""); err == nil {
+			t.Errorf("%v accepted", ids)
+		}
+	}
+}
+
+func TestSeqIsUniqueAcrossGoroutines(t *testing.T) {
+	sink := &recordingSink{}
+	configureTest(t, nil, Config{Sink: sink})
+	root := TraceCtx("", "", "")
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Log(Entry{Action: "a", Ctx: root.Child()})
+		}()
+	}
+	wg.Wait()
+	seen := map[uint64]bool{}
+	for _, body := range sink.entries {
+		var e entryBody
+		json.Unmarshal(body, &e)
+		if e.Seq < 1 || e.Seq > 50 || seen[e.Seq] {
+			t.Errorf("got seq %d twice or out of range", e.Seq)
+		}
+		seen[e.Seq] = true
+	}
+}
+
+// concurrencyHandler blocks each request until release is closed, recording
+// the most requests seen at once.
+type concurrencyHandler struct {
+	release          chan struct{}
+	mu               sync.Mutex
+	running, maximum int
+}
+
+func (h *concurrencyHandler) serve(w http.ResponseWriter, r *http.Request, body []byte) {
+	h.mu.Lock()
+	h.running++
+	if h.running > h.maximum {
+		h.maximum = h.running
+	}
+	h.mu.Unlock()
+	<-h.release
+	h.mu.Lock()
+	h.running--
+	h.mu.Unlock()
+}
+
+func (h *concurrencyHandler) seen() (running, maximum int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.running, h.maximum
+}
+
+func TestMaxInFlight(t *testing.T) {
+	s := newTestServer(t)
+	h := &concurrencyHandler{release: make(chan struct{})}
+	s.Handler = h.serve
+	configureTest(t, s, Config{MaxInFlight: 2})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 6)
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- Log(Entry{Action: "a", Ctx: TraceCtx("", "", "")})
+		}()
+	}
+	waitFor(t, "two requests", func() bool { running, _ := h.seen(); return running == 2 })
+	time.Sleep(20 * time.Millisecond)
+	close(h.release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("a waiting entry failed: %v", err)
+		}
+	}
+	if _, maximum := h.seen(); maximum != 2 {
+		t.Errorf("%d requests ran at once, want MaxInFlight 2", maximum)
+	}
+}
+
+func TestMaxInFlightFailFast(t *testing.T) {
+	s := newTestServer(t)
+	h := &concurrencyHandler{release: make(chan struct{})}
+	s.Handler = h.serve
+	configureTest(t, s, Config{MaxInFlight: 1, FailFast: true, MaxRetries: 3})
+
+	done := make(chan error, 1)
+	go func() { done <- Log(Entry{Action: "a", Ctx: TraceCtx("", "", "")}) }()
+	waitFor(t, "the first request", func() bool { running, _ := h.seen(); return running == 1 })
+	if err := Log(Entry{Action: "b", Ctx: TraceCtx("", "", "")}); err != ErrTooManyInFlight {
+		t.Errorf("got %v, want ErrTooManyInFlight", err)
+	}
+	close(h.release)
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	if len(s.Entries()) != 1 {
+		t.Errorf("got %d requests, want the rejected entry not retried", len(s.Entries()))
+	}
+}
+
+func TestMaxInFlightHonorsContext(t *testing.T) {
+	s := newTestServer(t)
+	h := &concurrencyHandler{release: make(chan struct{})}
+	defer close(h.release)
+	s.Handler = h.serve
+	configureTest(t, s, Config{MaxInFlight: 1})
+
+	go Log(Entry{Action: "a", Ctx: TraceCtx("", "", "")})
+	waitFor(t, "the first request", func() bool { running, _ := h.seen(); return running == 1 })
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := LogContext(ctx, Entry{Action: "b", Ctx: TraceCtx("", "", "")}); err != context.DeadlineExceeded {
+		t.Errorf("got %v, want the context's error while waiting", err)
+	}
+}
+
+func TestLogWithTags(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{})
+	e := Entry{Action: "a", Ctx: TraceCtx("", "", ""), Tags: make([]string, 1, 4)}
+	e.Tags[0] = "own"
+	if err := LogWithTags(context.Background(), e, "extra1", "extra2"); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Tags()) != 3 || s.Tags()[2]["tag"] != "extra2" {
+		t.Errorf("got tags %v", s.Tags())
+	}
+	if e.Tags[:2][1] != "" {
+		t.Error("LogWithTags wrote into the entry's Tags array")
+	}
+
+	// A failed entry sends no tags.
+	s.Handler = func(w http.ResponseWriter, r *http.Request, body []byte) {
+		if r.URL.Path == "/entries" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}
+	if err := LogWithTags(context.Background(), Entry{Action: "a", Ctx: TraceCtx("", "", "")}, "t"); err == nil {
+		t.Error("expected the entry's error")
+	}
+	if len(s.Tags()) != 3 {
+		t.Errorf("tags were sent for a failed entry")
+	}
+
+	// A failed tag gives a PartialError.
+	s.Handler = func(w http.ResponseWriter, r *http.Request, body []byte) {
+		if r.URL.Path == "/tags" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}
+	var partial *PartialError
+	if err := LogWithTags(context.Background(), Entry{Action: "a", Ctx: TraceCtx("", "", "")}, "t"); !errors.As(err, &partial) {
+		t.Errorf("got %v, want a PartialError", err)
+	}
+}
+
+func TestCurrentConfig(t *testing.T) {
+	configureTest(t, nil, Config{ApiKey: "secret", FieldNames: map[string]string{"type": "t"}, AllowKeys: []string{"k"}})
+	c := CurrentConfig()
+	if c.ApiKey != "REDACTED" || c.ApiURL != "https://api.quicklog.io" || c.Client == nil || c.ProjectID != 12345 {
+		t.Errorf("got %+v", c)
+	}
+	c.FieldNames["type"] = "changed"
+	c.AllowKeys[0] = "changed"
+	if again := CurrentConfig(); again.FieldNames["type"] != "t" || again.AllowKeys[0] != "k" {
+		t.Error("changing the returned Config changed the settings")
+	}
+}
+
+func TestMarshaler(t *testing.T) {
+	s := newTestServer(t)
+	var kinds []string
+	configureTest(t, s, Config{Marshaler: func(v interface{}) ([]byte, error) {
+		switch v.(type) {
+		case entryBody:
+			kinds = append(kinds, "entry")
+		case tagBody:
+			kinds = append(kinds, "tag")
+		}
+		return json.Marshal(v)
+	}})
+	if err := Log(Entry{Action: "a", Ctx: TraceCtx("", "", ""), Tags: []string{"t"}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(kinds) != 2 || kinds[0] != "entry" || kinds[1] != "tag" {
+		t.Errorf("Marshaler called for %v, want the entry and the tag", kinds)
+	}
+	if len(s.Entries()) != 1 || s.Entries()[0]["type"] != "a" {
+		t.Errorf("got %v", s.Entries())
+	}
+
+	configureTest(t, s, Config{Marshaler: func(v interface{}) ([]byte, error) { return nil, errors.New("cannot encode") }})
+	if err := Log(Entry{Action: "a", Ctx: TraceCtx("", "", "")}); err == nil || err.Error() != "cannot encode" {
+		t.Errorf("got %v, want the Marshaler's error", err)
+	}
+}
+
+func TestDisable(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{})
+	Disable()
+	traceCtx := TraceCtx("", "", "")
+	if err := Log(Entry{Action: "a", Ctx: traceCtx, Tags: []string{"t"}}); err != nil {
+		t.Errorf("disabled Log returned %v", err)
+	}
+	if err := TagTrace(traceCtx.TraceID, "t"); err != nil {
+		t.Errorf("disabled TagTrace returned %v", err)
+	}
+	LogDetached("a", "", "", nil, traceCtx)
+	Enable()
+	if len(s.Requests()) != 0 {
+		t.Errorf("sent %d requests while disabled", len(s.Requests()))
+	}
+	if err := Log(Entry{Action: "a", Ctx: traceCtx}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Entries()) != 1 {
+		t.Errorf("got %d entries, want only the one logged after Enable", len(s.Entries()))
+	}
+}
+
+func TestOnDelivered(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{MinLevel: LevelInfo})
+	traceCtx := TraceCtx("", "", "")
+	var results []error
+	tagsBefore := -1
+	onDelivered := func(err error) {
+		results = append(results, err)
+		tagsBefore = len(s.Tags())
+	}
+	if err := Log(Entry{Action: "a", Ctx: traceCtx, Tags: []string{"t"}, OnDelivered: onDelivered}); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0] != nil || tagsBefore != 0 {
+		t.Errorf("got %v with %d tags sent, want nil before the tags", results, tagsBefore)
+	}
+
+	if err := Log(Entry{Action: "a", Level: LevelDebug, Ctx: traceCtx, OnDelivered: onDelivered}); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Error("OnDelivered was called for an entry below MinLevel")
+	}
+
+	s.Handler = func(w http.ResponseWriter, r *http.Request, body []byte) { w.WriteHeader(http.StatusBadRequest) }
+	err := Log(Entry{Action: "a", Ctx: traceCtx, OnDelivered: onDelivered})
+	if err == nil || len(results) != 2 || results[1] != err {
+		t.Errorf("got %v, want the error Log returned (%v)", results, err)
+	}
+}
+
+func TestSendHooks(t *testing.T) {
+	s := newTestServer(t)
+	var calls []string
+	var afterErrs []error
+	configureTest(t, s, Config{
+		BeforeSend: []func(*Entry) bool{
+			func(e *Entry) bool { calls = append(calls, "first"); e.Object = "object:changed"; return true },
+			func(e *Entry) bool { calls = append(calls, "second"); return e.Action != "drop" },
+			func(e *Entry) bool { calls = append(calls, "third"); return true },
+		},
+		AfterSend: []func(Entry, error){
+			func(e Entry, err error) { calls = append(calls, "after "+e.Object); afterErrs = append(afterErrs, err) },
+			func(e Entry, err error) { calls = append(calls, "after2") },
+		},
+	})
+	traceCtx := TraceCtx("", "", "")
+	if err := Log(Entry{Action: "a", Object: "object:1", Ctx: traceCtx}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Log(Entry{Action: "drop", Ctx: traceCtx}); err != nil {
+		t.Fatal(err)
+	}
+	want := "first second third after object:changed after2 first second"
+	if got := strings.Join(calls, " "); got != want {
+		t.Errorf("got hooks %q, want %q", got, want)
+	}
+	if entries := s.Entries(); len(entries) != 1 || entries[0]["object"] != "object:changed" {
+		t.Errorf("got entries %v, want only the changed one", entries)
+	}
+
+	s.Handler = func(w http.ResponseWriter, r *http.Request, body []byte) { w.WriteHeader(http.StatusBadRequest) }
+	err := Log(Entry{Action: "a", Ctx: traceCtx})
+	if err == nil || len(afterErrs) != 2 || afterErrs[0] != nil || afterErrs[1] != err {
+		t.Errorf("AfterSend got %v, want nil then %v", afterErrs, err)
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{
+		FieldNames: map[string]string{"type": "action"},
+		Envelope: func(body interface{}) interface{} {
+			return map[string]interface{}{"v": 1, "payload": body}
+		},
+	})
+	if err := Log(Entry{Action: "a", Ctx: TraceCtx("", "", ""), Tags: []string{"t"}}); err != nil {
+		t.Fatal(err)
+	}
+	e := s.Entries()[0]
+	payload, ok := e["payload"].(map[string]interface{})
+	if e["v"] != float64(1) || !ok || payload["action"] != "a" {
+		t.Errorf("got %v, want the renamed entry wrapped", e)
+	}
+	if tags := s.Tags(); len(tags) != 1 || tags[0]["tag"] != "t" {
+		t.Errorf("got tags %v, want them unwrapped", tags)
+	}
+}
+
+func TestNewTrace(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{})
+	parent := TraceCtx("user:1", "", "").Child()
+	fresh := parent.NewTrace()
+	if fresh.ActorID != "user:1" || fresh.TraceID == parent.TraceID || fresh.ParentSpanID != "" {
+		t.Errorf("got %+v from %+v", fresh, parent)
+	}
+	for _, c := range []Ctx{parent, parent, fresh} {
+		if err := Log(Entry{Action: "a", Ctx: c}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if entries := s.Entries(); entries[1]["seq"] != float64(2) || entries[2]["seq"] != float64(1) {
+		t.Errorf("got seqs %v, %v, want the new trace to start over", entries[1]["seq"], entries[2]["seq"])
+	}
+}
+
+func TestDeadlineRemaining(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{DeadlineRemaining: true})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	traceCtx := TraceCtx("", "", "")
+	own := map[string]interface{}{"deadline_remaining_ms": "mine"}
+	for _, e := range []Entry{
+		{Action: "a", Ctx: traceCtx},
+		{Action: "a", Extra: own, Ctx: traceCtx},
+	} {
+		if err := LogContext(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := LogContext(context.Background(), Entry{Action: "a", Ctx: traceCtx}); err != nil {
+		t.Fatal(err)
+	}
+	entries := s.Entries()
+	remaining, _ := entries[0]["context"].(map[string]interface{})["deadline_remaining_ms"].(float64)
+	if remaining <= 50000 || remaining > 60000 {
+		t.Errorf("got %v ms remaining, want about a minute", remaining)
+	}
+	if got := entries[1]["context"].(map[string]interface{})["deadline_remaining_ms"]; got != "mine" {
+		t.Errorf("got %v, want the entry's own key", got)
+	}
+	if entries[2]["context"] != nil {
+		t.Errorf("got context %v without a deadline", entries[2]["context"])
+	}
+	if len(own) != 1 {
+		t.Errorf("the caller's extra was changed to %v", own)
+	}
+}
+
+func TestOnTimings(t *testing.T) {
+	s := newTestServer(t)
+	sizes := make(chan int, 1)
+	s.Handler = func(w http.ResponseWriter, r *http.Request, body []byte) {
+		if strings.HasPrefix(r.URL.Path, "/entries") {
+			sizes <- len(body)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	var timings []Timings
+	configureTest(t, s, Config{OnTimings: func(e Entry, t Timings) { timings = append(timings, t) }})
+	if err := Log(Entry{Action: "a", Ctx: TraceCtx("", "", ""), Tags: []string{"t"}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(timings) != 1 {
+		t.Fatalf("got %d timings, want one for the entry", len(timings))
+	}
+	if got := timings[0]; got.Send < 20*time.Millisecond || got.Serialize < 0 || got.Size != <-sizes {
+		t.Errorf("got %+v", got)
+	}
+
+	s.Handler = func(w http.ResponseWriter, r *http.Request, body []byte) { w.WriteHeader(http.StatusBadRequest) }
+	if err := Log(Entry{Action: "a", Ctx: TraceCtx("", "", "")}); err == nil {
+		t.Fatal("expected the 400")
+	}
+	if len(timings) != 2 {
+		t.Errorf("got %d timings, want one for the failed entry too", len(timings))
+	}
+}
+
+func TestOnDeliveredReportsEveryOutcome(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{
+		ControlChars: ControlCharsReject,
+		ActionRates:  map[string]Rate{"limited": {PerSecond: 0.001, Burst: 1}},
+		BeforeSend:   []func(*Entry) bool{func(e *Entry) bool { return e.Action != "vetoed" }},
+	})
+	result := make(chan error, 1)
+	onDelivered := func(err error) { result <- err }
+	wait := func(what string) error {
+		select {
+		case err := <-result:
+			return err
+		case <-time.After(5 * time.Second):
+			t.Fatalf("OnDelivered wasn't called for %s", what)
+			return nil
+		}
+	}
+
+	LogEntryDetached(Entry{Action: "a\x00", Ctx: TraceCtx("", "", ""), OnDelivered: onDelivered})
+	if err := wait("an invalid entry"); err == nil || err == ErrDropped {
+		t.Errorf("got %v, want the validation error", err)
+	}
+	for i, want := range []error{nil, ErrDropped} {
+		if err := Log(Entry{Action: "limited", Ctx: TraceCtx("", "", ""), OnDelivered: onDelivered}); err != nil {
+			t.Fatal(err)
+		}
+		if err := wait("a rate limited entry"); err != want {
+			t.Errorf("entry %d: got %v, want %v", i, err, want)
+		}
+	}
+	if err := Log(Entry{Action: "vetoed", Ctx: TraceCtx("", "", ""), OnDelivered: onDelivered}); err != nil {
+		t.Fatal(err)
+	}
+	if err := wait("an entry dropped by BeforeSend"); err != ErrDropped {
+		t.Errorf("got %v, want ErrDropped", err)
+	}
+	if len(result) != 0 || len(s.Entries()) != 1 {
+		t.Errorf("OnDelivered was called more than once, or %d entries were sent", len(s.Entries()))
+	}
+}
+
+func TestRequestSigner(t *testing.T) {
+	s := newTestServer(t)
+	sign := func(body []byte) string {
+		sum := sha256.Sum256(body)
+		return hex.EncodeToString(sum[:])
+	}
+	var mu sync.Mutex
+	var received []string
+	fail := failingHandler(nil, http.StatusServiceUnavailable)
+	s.Handler = func(w http.ResponseWriter, r *http.Request, body []byte) {
+		mu.Lock()
+		received = append(received, r.URL.Path+" "+r.Header.Get("X-Signature")+" "+r.Header.Get("X-Signed"))
+		if r.Header.Get("X-Signature") != sign(body) {
+			t.Errorf("%s: signature doesn't match the body %q", r.URL.Path, body)
+		}
+		mu.Unlock()
+		fail(w, r, body)
+	}
+	var signed int32
+	configureTest(t, s, Config{
+		MaxRetries: 1,
+		Backoff:    ConstantBackoff{},
+		RequestSigner: func(req *http.Request, body []byte) error {
+			req.Header.Set("X-Signature", sign(body))
+			req.Header.Set("X-Signed", strconv.Itoa(int(atomic.AddInt32(&signed, 1))))
+			return nil
+		},
+	})
+	traceCtx := TraceCtx("", "", "")
+	if err := Log(Entry{Action: "a", Ctx: traceCtx}); err != nil {
+		t.Fatal(err)
+	}
+	if err := TagTrace(traceCtx.TraceID, "t"); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 3 || !strings.HasSuffix(received[0], " 1") || !strings.HasSuffix(received[1], " 2") || !strings.HasPrefix(received[2], "/tags") {
+		t.Errorf("got requests %q, want the retry signed again and the tag signed", received)
+	}
+
+	configureTest(t, s, Config{RequestSigner: func(req *http.Request, body []byte) error { return errors.New("no key") }})
+	if err := Log(Entry{Action: "a", Ctx: traceCtx}); err == nil || !strings.Contains(err.Error(), "no key") {
+		t.Errorf("got %v, want the signer's error", err)
+	}
+}
+
+func TestZeroPublishedIsNow(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{})
+	before := time.Now().Add(-time.Second)
+	if err := Log(Entry{Action: "a", Ctx: TraceCtx("", "", "")}); err != nil {
+		t.Fatal(err)
+	}
+	LogEntryDetached(Entry{Action: "b", Ctx: TraceCtx("", "", "")})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	entries := s.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	for _, e := range entries {
+		published, err := time.Parse(time.RFC3339Nano, e["published"].(string))
+		if err != nil || published.Before(before) || published.After(time.Now()) {
+			t.Errorf("%s: got published %v, want now", e["type"], e["published"])
+		}
+	}
+}
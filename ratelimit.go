@@ -0,0 +1,91 @@
+package quicklog
+
+import (
+	"sync"
+	"time"
+)
+
+// Rate is a token bucket rate: PerSecond entries per second on average, with
+// bursts of up to Burst (at least 1). A zero PerSecond means no limit.
+type Rate struct {
+	PerSecond float64
+	Burst     int
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps a token bucket per key.
+type rateLimiter struct {
+	rates  map[string]Rate
+	def    Rate
+	mu     sync.Mutex
+	bucket map[string]*bucket
+}
+
+func newRateLimiter(rates map[string]Rate, def Rate) *rateLimiter {
+	copied := make(map[string]Rate, len(rates))
+	for k, r := range rates {
+		copied[k] = r
+	}
+	return &rateLimiter{rates: copied, def: def, bucket: make(map[string]*bucket)}
+}
+
+// maxBuckets is how many buckets a rateLimiter keeps before dropping those
+// that have refilled, which would behave the same if recreated. It keeps
+// limiting by unbounded keys, such as actors, from growing without end.
+const maxBuckets = 4096
+
+func (l *rateLimiter) rate(key string) (Rate, float64) {
+	rate, ok := l.rates[key]
+	if !ok {
+		rate = l.def
+	}
+	burst := float64(rate.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	return rate, burst
+}
+
+// allow reports whether an entry for key may be sent now, taking a token if so.
+func (l *rateLimiter) allow(key string) bool {
+	rate, burst := l.rate(key)
+	if rate.PerSecond <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	b, ok := l.bucket[key]
+	if !ok {
+		if len(l.bucket) >= maxBuckets {
+			l.prune(now)
+		}
+		b = &bucket{tokens: burst, last: now}
+		l.bucket[key] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * rate.PerSecond
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// prune deletes the buckets that are full again. l.mu must be held.
+func (l *rateLimiter) prune(now time.Time) {
+	for key, b := range l.bucket {
+		rate, burst := l.rate(key)
+		if b.tokens+now.Sub(b.last).Seconds()*rate.PerSecond >= burst {
+			delete(l.bucket, key)
+		}
+	}
+}
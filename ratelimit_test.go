@@ -0,0 +1,64 @@
+package quicklog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestActionRates(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{
+		ActionRates:       map[string]Rate{"noisy": {PerSecond: 0.001, Burst: 2}, "free": {}},
+		DefaultActionRate: Rate{PerSecond: 0.001},
+	})
+	counts := map[string]int{}
+	for i := 0; i < 5; i++ {
+		for _, action := range []string{"noisy", "free", "other"} {
+			if err := Log(Entry{Action: action, Ctx: TraceCtx("", "", "")}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for _, e := range s.Entries() {
+		counts[e["type"].(string)]++
+	}
+	if counts["noisy"] != 2 || counts["free"] != 5 || counts["other"] != 1 {
+		t.Errorf("sent %v, want noisy 2, free 5 and other 1", counts)
+	}
+}
+
+func TestActorRates(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{
+		ActorRates:       map[string]Rate{"user:busy": {PerSecond: 0.001, Burst: 3}},
+		DefaultActorRate: Rate{PerSecond: 0.001},
+	})
+	counts := map[string]int{}
+	for i := 0; i < 5; i++ {
+		for _, actor := range []string{"user:busy", "user:1", "user:2", ""} {
+			if err := Log(Entry{Action: "a", Ctx: TraceCtx(actor, "", "")}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for _, e := range s.Entries() {
+		counts[e["actor"].(string)]++
+	}
+	if counts["user:busy"] != 3 || counts["user:1"] != 1 || counts["user:2"] != 1 || counts[""] != 1 {
+		t.Errorf("sent %v, want user:busy 3 and 1 for each other actor", counts)
+	}
+}
+
+func TestRateLimiterRefills(t *testing.T) {
+	l := newRateLimiter(nil, Rate{PerSecond: 1000, Burst: 1})
+	if !l.allow("a") || l.allow("a") {
+		t.Fatal("a burst of 1 didn't allow exactly one entry")
+	}
+	time.Sleep(5 * time.Millisecond)
+	if !l.allow("a") {
+		t.Error("the bucket didn't refill")
+	}
+	if !l.allow("b") {
+		t.Error("keys share a bucket")
+	}
+}
@@ -0,0 +1,206 @@
+package quicklog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+/**
+ * Fetches the entries logged for a trace, following pagination cursors.
+ * @param {context.Context} ctx
+ * @param {string} traceID
+ * @return []Entry, error
+ */
+func GetTrace(ctx context.Context, traceID string) ([]Entry, error) {
+	var entries []Entry
+	err := StreamTrace(ctx, traceID, func(e Entry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+/**
+ * Same as GetTrace, but decodes the entries one at a time and passes each to
+ * fn, so memory use doesn't grow with the size of the trace. If fn returns an
+ * error, streaming stops and that error is returned. Returns ErrDisabled
+ * without a request while sending is disabled.
+ * @param {context.Context} ctx
+ * @param {string} traceID
+ * @param {func} fn
+ * @return error
+ */
+func StreamTrace(ctx context.Context, traceID string, fn func(Entry) error) error {
+	if traceID == "" {
+		return fmt.Errorf("'traceID' must be a non-empty string")
+	}
+	if isDisabled() {
+		return ErrDisabled
+	}
+	cfg := loadSettings()
+	if cfg.ProjectID == 0 {
+		return fmt.Errorf("ProjectID must be set in Config options")
+	}
+	if err := checkAPIConfig(cfg); err != nil {
+		return err
+	}
+	ctx = withSettings(ctx, cfg)
+
+	cursor := ""
+	for {
+		next, err := streamEntries(ctx, traceID, cursor, fn)
+		if err != nil {
+			return err
+		}
+		if next == "" || next == cursor {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// streamEntries fetches one page, passing its entries to fn, and returns the
+// cursor of the next page. The API returns a page either as a bare array of
+// entries or as {"entries": [...], "cursor": "..."}.
+func streamEntries(ctx context.Context, traceID, cursor string, fn func(Entry) error) (string, error) {
+	cfg := settingsFrom(ctx)
+	query := url.Values{}
+	query.Set("project_id", strconv.Itoa(cfg.ProjectID))
+	query.Set("trace_id", traceID)
+	query.Set("api_key", cfg.ApiKey)
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.ApiURL+"/entries?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", userAgent(cfg))
+
+	release, err := acquireInFlight(ctx, cfg)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	if cfg.OnRequest != nil {
+		cfg.OnRequest(req)
+	}
+	start := time.Now()
+	resp, err := httpClient(ctx).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if cfg.OnResponse != nil {
+		// The body is streamed, so the hook only sees the status and headers.
+		hookResp := *resp
+		hookResp.Body = http.NoBody
+		cfg.OnResponse(&hookResp, time.Since(start))
+	}
+	if resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return "", statusError(resp, body)
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	tok, err := dec.Token()
+	if err != nil {
+		return "", err
+	}
+	switch tok {
+	case json.Delim('['):
+		return "", decodeEntries(dec, fn)
+	case json.Delim('{'):
+	default:
+		return "", fmt.Errorf("unexpected %v in entries response", tok)
+	}
+
+	next := ""
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return "", err
+		}
+		switch key {
+		case "entries":
+			if tok, err := dec.Token(); err != nil {
+				return "", err
+			} else if tok != json.Delim('[') {
+				return "", fmt.Errorf("unexpected %v for entries", tok)
+			}
+			if err := decodeEntries(dec, fn); err != nil {
+				return "", err
+			}
+		case "cursor":
+			if err := dec.Decode(&next); err != nil {
+				return "", err
+			}
+		default:
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return "", err
+			}
+		}
+	}
+	return next, nil
+}
+
+// decodeEntries decodes the rest of a JSON array whose '[' has been read.
+func decodeEntries(dec *json.Decoder, fn func(Entry) error) error {
+	for dec.More() {
+		var e Entry
+		if err := dec.Decode(&e); err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	_, err := dec.Token()
+	return err
+}
+
+// UnmarshalJSON decodes an entry as returned by the API.
+func (e *Entry) UnmarshalJSON(data []byte) error {
+	var body struct {
+		entryBody
+		Context map[string]interface{} `json:"context"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return err
+	}
+	published := time.Time{}
+	if body.Published != nil {
+		published = *body.Published
+	}
+	*e = Entry{
+		Published: published,
+		Level:     body.Level,
+		Action:    body.Type,
+		Object:    body.Object,
+		Target:    body.Target,
+		Extra:     body.Context,
+		Ctx: Ctx{
+			ActorID:      body.Actor,
+			TraceID:      body.TraceID,
+			ParentSpanID: body.ParentSpanID,
+			SpanID:       body.SpanID,
+		},
+		ProjectID:     body.ProjectID,
+		Links:         body.Links,
+		Events:        body.Events,
+		RetentionDays: body.RetentionDays,
+	}
+	return nil
+}
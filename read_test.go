@@ -0,0 +1,159 @@
+package quicklog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGetTraceWhileDisabled(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{})
+	Disable()
+	defer Enable()
+	if _, err := GetTrace(context.Background(), "trace"); err != ErrDisabled {
+		t.Errorf("got %v, want ErrDisabled", err)
+	}
+	if len(s.Requests()) != 0 {
+		t.Errorf("made %d requests while disabled", len(s.Requests()))
+	}
+}
+
+func TestGetTraceFollowsCursors(t *testing.T) {
+	s := newTestServer(t)
+	s.Handler = func(w http.ResponseWriter, r *http.Request, body []byte) {
+		switch r.URL.Query().Get("cursor") {
+		case "":
+			w.Write([]byte(`{"entries":[{"type":"first","trace_id":"trace","span_id":"s1","actor":"user:1","context":{"k":"v"}}],"cursor":"page2"}`))
+		case "page2":
+			w.Write([]byte(`{"entries":[{"type":"second","trace_id":"trace","parent_span_id":"s1","span_id":"s2"}],"cursor":""}`))
+		}
+	}
+	configureTest(t, s, Config{})
+	entries, err := GetTrace(context.Background(), "trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Action != "first" || entries[1].Action != "second" {
+		t.Fatalf("got %+v", entries)
+	}
+	if c := entries[0].Ctx; c.TraceID != "trace" || c.SpanID != "s1" || c.ActorID != "user:1" || entries[0].Extra["k"] != "v" {
+		t.Errorf("got %+v", entries[0])
+	}
+	if entries[1].Ctx.ParentSpanID != "s1" {
+		t.Errorf("got %+v", entries[1].Ctx)
+	}
+	query := s.Requests()[0].URL.Query()
+	if query.Get("trace_id") != "trace" || query.Get("project_id") != "12345" || query.Get("api_key") != "test-key" {
+		t.Errorf("got query %v", query)
+	}
+}
+
+func TestGetTraceErrors(t *testing.T) {
+	s := newTestServer(t)
+	s.Handler = func(w http.ResponseWriter, r *http.Request, body []byte) {
+		http.Error(w, "no such project", http.StatusNotFound)
+	}
+	configureTest(t, s, Config{})
+	if _, err := GetTrace(context.Background(), "trace"); err == nil || !strings.Contains(err.Error(), "no such project") {
+		t.Errorf("got %v, want the 404 body", err)
+	}
+	if _, err := GetTrace(context.Background(), ""); err == nil {
+		t.Error("an empty trace ID was accepted")
+	}
+}
+
+func TestStreamTrace(t *testing.T) {
+	s := newTestServer(t)
+	s.Handler = func(w http.ResponseWriter, r *http.Request, body []byte) {
+		w.Write([]byte(`[{"type":"a"},{"type":"b"},{"type":"c"}]`))
+	}
+	configureTest(t, s, Config{})
+	var actions []string
+	stop := errors.New("stop")
+	err := StreamTrace(context.Background(), "trace", func(e Entry) error {
+		actions = append(actions, e.Action)
+		if e.Action == "b" {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || len(actions) != 2 {
+		t.Errorf("got %v after %v, want fn's error after a and b", err, actions)
+	}
+
+	s.Handler = func(w http.ResponseWriter, r *http.Request, body []byte) {
+		w.Write([]byte(`{"entries":[{"type":"a"},`))
+	}
+	if err := StreamTrace(context.Background(), "trace", func(Entry) error { return nil }); err == nil {
+		t.Error("a truncated response wasn't an error")
+	}
+}
+
+// readCounter counts the bytes read from response bodies.
+type readCounter struct {
+	http.RoundTripper
+	n int64
+}
+
+func (c *readCounter) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := c.RoundTripper.RoundTrip(req)
+	if err == nil {
+		resp.Body = &countedBody{resp.Body, &c.n}
+	}
+	return resp, err
+}
+
+type countedBody struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (b *countedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	atomic.AddInt64(b.n, int64(n))
+	return n, err
+}
+
+func TestStreamTraceDoesNotBufferThePage(t *testing.T) {
+	const perPage = 5000
+	s := newTestServer(t)
+	s.Handler = func(w http.ResponseWriter, r *http.Request, body []byte) {
+		page := r.URL.Query().Get("cursor")
+		w.Write([]byte(`{"entries":[`))
+		for i := 0; i < perPage; i++ {
+			if i > 0 {
+				w.Write([]byte(","))
+			}
+			fmt.Fprintf(w, `{"type":"a","trace_id":"trace","span_id":"%016x","context":{"pad":%q}}`, i+1, strings.Repeat("x", 200))
+		}
+		if page == "" {
+			w.Write([]byte(`],"cursor":"page2"}`))
+		} else {
+			w.Write([]byte(`],"cursor":""}`))
+		}
+	}
+	counter := &readCounter{RoundTripper: http.DefaultTransport}
+	configureTest(t, s, Config{Client: &http.Client{Transport: counter}})
+	count := 0
+	var readAtFirst int64
+	err := StreamTrace(context.Background(), "trace", func(e Entry) error {
+		if count == 0 {
+			readAtFirst = atomic.LoadInt64(&counter.n)
+		}
+		count++
+		return nil
+	})
+	if err != nil || count != 2*perPage {
+		t.Fatalf("got %v after %d entries, want %d", err, count, 2*perPage)
+	}
+	// Each page is over 1MB; the decoder reads a few KB ahead at most.
+	if total := atomic.LoadInt64(&counter.n); readAtFirst > 64<<10 || total < 2<<20 {
+		t.Errorf("had read %d of %d bytes when fn got the first entry", readAtFirst, total)
+	}
+}
@@ -0,0 +1,124 @@
+package quicklog
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+//go:embed entry.schema.json
+var entrySchemaJSON []byte
+
+// schema is the subset of JSON Schema used by entry.schema.json.
+type schema struct {
+	Type       interface{}        `json:"type"`
+	Required   []string           `json:"required"`
+	Properties map[string]*schema `json:"properties"`
+	MinLength  *int               `json:"minLength"`
+	Minimum    *float64           `json:"minimum"`
+	Enum       []interface{}      `json:"enum"`
+}
+
+var entrySchema = func() *schema {
+	var s schema
+	if err := json.Unmarshal(entrySchemaJSON, &s); err != nil {
+		panic("quicklog: invalid entry.schema.json: " + err.Error())
+	}
+	return &s
+}()
+
+// validateEntry checks a marshaled entry body against the embedded schema.
+func validateEntry(content []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(content, &v); err != nil {
+		return err
+	}
+	if err := entrySchema.validate("entry", v); err != nil {
+		return fmt.Errorf("invalid entry: %v", err)
+	}
+	return nil
+}
+
+func (s *schema) validate(path string, v interface{}) error {
+	if !s.typeMatches(v) {
+		return fmt.Errorf("%s must be of type %v", path, s.Type)
+	}
+	if len(s.Enum) != 0 {
+		found := false
+		for _, allowed := range s.Enum {
+			if allowed == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s must be one of %v", path, s.Enum)
+		}
+	}
+	switch v := v.(type) {
+	case string:
+		if s.MinLength != nil && len(v) < *s.MinLength {
+			return fmt.Errorf("%s must be at least %d characters", path, *s.MinLength)
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			return fmt.Errorf("%s must be at least %v", path, *s.Minimum)
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("%s.%s is required", path, name)
+			}
+		}
+		for name, property := range s.Properties {
+			if value, ok := v[name]; ok {
+				if err := property.validate(path+"."+name, value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *schema) typeMatches(v interface{}) bool {
+	var types []string
+	switch t := s.Type.(type) {
+	case nil:
+		return true
+	case string:
+		types = []string{t}
+	case []interface{}:
+		for _, name := range t {
+			types = append(types, fmt.Sprint(name))
+		}
+	}
+	for _, name := range types {
+		if jsonType(v) == name || name == "number" && jsonType(v) == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonType(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
@@ -0,0 +1,39 @@
+package quicklog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateEntry(t *testing.T) {
+	valid := `{"project_id":1,"type":"a","trace_id":"t","span_id":"s","level":"warn","context":null}`
+	if err := validateEntry([]byte(valid)); err != nil {
+		t.Errorf("valid entry rejected: %v", err)
+	}
+	for body, want := range map[string]string{
+		`{"type":"a","trace_id":"t","span_id":"s"}`:                                "entry.project_id is required",
+		`{"project_id":0,"type":"a","trace_id":"t","span_id":"s"}`:                 "entry.project_id must be at least 1",
+		`{"project_id":1.5,"type":"a","trace_id":"t","span_id":"s"}`:               "entry.project_id must be of type integer",
+		`{"project_id":1,"type":"","trace_id":"t","span_id":"s"}`:                  "entry.type must be at least 1 characters",
+		`{"project_id":1,"type":"a","trace_id":"t","span_id":"s","level":"fatal"}`: "entry.level must be one of",
+		`{"project_id":1,"type":"a","trace_id":"t","span_id":"s","context":[]}`:    "entry.context must be of type",
+	} {
+		if err := validateEntry([]byte(body)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got %v, want %q", body, err, want)
+		}
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{ValidateSchema: true})
+	if err := Log(Entry{Action: "a", Level: LevelInfo, Extra: map[string]interface{}{"k": 1}, Ctx: TraceCtx("", "", "")}); err != nil {
+		t.Errorf("entry failed validation: %v", err)
+	}
+	if err := Log(Entry{Ctx: TraceCtx("", "", "")}); err == nil || !strings.Contains(err.Error(), "entry.type") {
+		t.Errorf("got %v for an entry without a type, want a schema error", err)
+	}
+	if len(s.Entries()) != 1 {
+		t.Errorf("got %d entries, want 1", len(s.Entries()))
+	}
+}
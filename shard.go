@@ -0,0 +1,102 @@
+package quicklog
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync/atomic"
+)
+
+type traceIDKey struct{}
+
+// withTraceID records the trace an entry or tag body belongs to, for sinks
+// such as ShardSink that route by trace without parsing the body.
+func withTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceIDKey{}, traceID)
+}
+
+/**
+ * Returns the trace ID of the entry or tag being sent, for use in a Sink.
+ * @param {context.Context} ctx the context passed to SendEntry or SendTag
+ * @return string, empty if unknown
+ */
+func TraceIDFromContext(ctx context.Context) string {
+	traceID, _ := ctx.Value(traceIDKey{}).(string)
+	return traceID
+}
+
+// shardReplicas is how many points each shard has on the hash ring.
+const shardReplicas = 64
+
+type shardSink struct {
+	shards []Sink
+	ring   []uint32 // sorted points
+	owner  map[uint32]int
+	next   uint32
+}
+
+/**
+ * Returns a Sink that sends each entry and tag to one of shards, chosen by
+ * consistent hashing of its trace ID so that a whole trace lands on one shard,
+ * e.g. ShardSink(APISink(url1, key), APISink(url2, key)). Shards are placed
+ * on the ring by position, so adding one at the end only moves the traces
+ * that now belong to it. Bodies with no trace ID go to the shards in turn.
+ * @param {...Sink} shards
+ * @return Sink
+ */
+func ShardSink(shards ...Sink) Sink {
+	s := &shardSink{shards: append([]Sink(nil), shards...), owner: make(map[uint32]int)}
+	for i := range s.shards {
+		for r := 0; r < shardReplicas; r++ {
+			point := hash32(strconv.Itoa(i) + "#" + strconv.Itoa(r))
+			if _, taken := s.owner[point]; taken {
+				continue
+			}
+			s.owner[point] = i
+			s.ring = append(s.ring, point)
+		}
+	}
+	sort.Slice(s.ring, func(i, j int) bool { return s.ring[i] < s.ring[j] })
+	return s
+}
+
+func hash32(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
+
+// shard returns the sink for ctx's trace.
+func (s *shardSink) shard(ctx context.Context) (Sink, error) {
+	if len(s.shards) == 0 {
+		return nil, errors.New("ShardSink has no shards")
+	}
+	traceID := TraceIDFromContext(ctx)
+	if traceID == "" {
+		return s.shards[int(atomic.AddUint32(&s.next, 1)-1)%len(s.shards)], nil
+	}
+	point := hash32(traceID)
+	i := sort.Search(len(s.ring), func(i int) bool { return s.ring[i] >= point })
+	if i == len(s.ring) {
+		i = 0
+	}
+	return s.shards[s.owner[s.ring[i]]], nil
+}
+
+func (s *shardSink) SendEntry(ctx context.Context, body []byte) error {
+	shard, err := s.shard(ctx)
+	if err != nil {
+		return err
+	}
+	return shard.SendEntry(ctx, body)
+}
+
+func (s *shardSink) SendTag(ctx context.Context, body []byte) error {
+	shard, err := s.shard(ctx)
+	if err != nil {
+		return err
+	}
+	return shard.SendTag(ctx, body)
+}
@@ -0,0 +1,74 @@
+package quicklog
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+// traceSink records the trace ID of each entry and tag it is sent.
+type traceSink struct {
+	mu     sync.Mutex
+	traces []string
+}
+
+func (s *traceSink) SendEntry(ctx context.Context, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.traces = append(s.traces, TraceIDFromContext(ctx))
+	return nil
+}
+
+func (s *traceSink) SendTag(ctx context.Context, body []byte) error { return s.SendEntry(ctx, body) }
+
+func TestShardSink(t *testing.T) {
+	shards := []*traceSink{{}, {}, {}}
+	configureTest(t, nil, Config{Sink: ShardSink(shards[0], shards[1], shards[2])})
+	for i := 0; i < 30; i++ {
+		if err := Log(Entry{Action: "a", Ctx: TraceCtx("", "", ""), Tags: []string{"t"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	owner := map[string]int{}
+	for i, shard := range shards {
+		if len(shard.traces) == 0 {
+			t.Errorf("shard %d got nothing", i)
+		}
+		for _, traceID := range shard.traces {
+			if j, seen := owner[traceID]; seen && j != i {
+				t.Errorf("trace %s went to shards %d and %d", traceID, j, i)
+			}
+			owner[traceID] = i
+		}
+	}
+	if len(owner) != 30 {
+		t.Fatalf("got %d traces, want 30", len(owner))
+	}
+
+	grown := ShardSink(&traceSink{}, &traceSink{}, &traceSink{}, &traceSink{}).(*shardSink)
+	for traceID, i := range owner {
+		shard, _ := grown.shard(withTraceID(context.Background(), traceID))
+		if j := indexOf(grown.shards, shard); j != i && j != 3 {
+			t.Errorf("adding a shard moved trace %s from %d to %d", traceID, i, j)
+		}
+	}
+
+	untraced := ShardSink(shards[0], shards[1]).(*shardSink)
+	first, _ := untraced.shard(context.Background())
+	second, _ := untraced.shard(context.Background())
+	if first == second {
+		t.Error("bodies without a trace ID didn't go to the shards in turn")
+	}
+	if err := ShardSink().SendEntry(context.Background(), []byte("{}")); err == nil {
+		t.Error("a ShardSink with no shards accepted an entry")
+	}
+}
+
+func indexOf(sinks []Sink, sink Sink) int {
+	for i, s := range sinks {
+		if s == sink {
+			return i
+		}
+	}
+	return -1
+}
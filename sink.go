@@ -0,0 +1,280 @@
+package quicklog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Sink receives the JSON bodies of entries and tags. Implementations must not
+// retain body after returning.
+type Sink interface {
+	SendEntry(ctx context.Context, body []byte) error
+	SendTag(ctx context.Context, body []byte) error
+}
+
+// ConsoleSink writes entries and tags to W as readable one-line summaries
+// instead of sending them, e.g. for local development:
+//
+//	2024-01-02T15:04:05Z a-type object:1 -> target:2 [key=value]
+//	2024-01-02T15:04:05Z tag 3f2a9c... {name1:value1}
+//
+// Entries are shown as logged, before Config.FieldNames and Envelope.
+type ConsoleSink struct {
+	W     io.Writer
+	Color bool
+
+	mu sync.Mutex
+}
+
+const (
+	colorDim   = "\x1b[2m"
+	colorBold  = "\x1b[1m"
+	colorCyan  = "\x1b[36m"
+	colorReset = "\x1b[0m"
+)
+
+type plainBodyKey struct{}
+
+// withPlainBody records the entry body as marshaled, before FieldNames and
+// Envelope changed its shape, for sinks such as ConsoleSink that read it.
+func withPlainBody(ctx context.Context, body []byte) context.Context {
+	return context.WithValue(ctx, plainBodyKey{}, body)
+}
+
+func (s *ConsoleSink) SendEntry(ctx context.Context, body []byte) error {
+	if plain, ok := ctx.Value(plainBodyKey{}).([]byte); ok {
+		body = plain
+	}
+	var e entryBody
+	if err := json.Unmarshal(body, &e); err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	published := time.Now()
+	if e.Published != nil {
+		published = *e.Published
+	}
+	b.WriteString(s.paint(colorDim, published.Format(time.RFC3339)))
+	if e.Level != 0 {
+		b.WriteString(" " + strings.ToUpper(e.Level.String()))
+	}
+	b.WriteString(" " + s.paint(colorBold, e.Type))
+	if e.Object != "" {
+		b.WriteString(" " + e.Object)
+	}
+	if e.Target != "" {
+		b.WriteString(" -> " + e.Target)
+	}
+	if extra, ok := e.Context.(map[string]interface{}); ok && len(extra) != 0 {
+		keys := make([]string, 0, len(extra))
+		for k := range extra {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fields := make([]string, len(keys))
+		for i, k := range keys {
+			fields[i] = fmt.Sprintf("%s=%v", k, consoleValue(extra[k]))
+		}
+		b.WriteString(" " + s.paint(colorCyan, "["+strings.Join(fields, " ")+"]"))
+	}
+	return s.writeLine(b.String())
+}
+
+func (s *ConsoleSink) SendTag(ctx context.Context, body []byte) error {
+	var t tagBody
+	if err := json.Unmarshal(body, &t); err != nil {
+		return err
+	}
+	line := s.paint(colorDim, time.Now().Format(time.RFC3339)) + " tag " + t.TraceID + " " + s.paint(colorCyan, "{"+t.Tag+"}")
+	return s.writeLine(line)
+}
+
+func (s *ConsoleSink) paint(color, text string) string {
+	if !s.Color {
+		return text
+	}
+	return color + text + colorReset
+}
+
+func (s *ConsoleSink) writeLine(line string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := io.WriteString(s.W, line+"\n")
+	return err
+}
+
+// consoleValue renders nested extra values as compact JSON.
+func consoleValue(v interface{}) interface{} {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		if content, err := json.Marshal(v); err == nil {
+			return string(content)
+		}
+	}
+	return v
+}
+
+type multiSink []Sink
+
+/**
+ * Returns a Sink that sends each entry and tag to every one of sinks, in
+ * order, and returns their errors joined. Wrap a sink with Shadow so that its
+ * failures are only logged, e.g. a new backend being checked for parity.
+ * @param {...Sink} sinks
+ * @return Sink
+ */
+func MultiSink(sinks ...Sink) Sink {
+	return multiSink(append([]Sink(nil), sinks...))
+}
+
+func (m multiSink) SendEntry(ctx context.Context, body []byte) error {
+	var errs []error
+	for _, s := range m {
+		if err := s.SendEntry(ctx, body); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors(errs)
+}
+
+func (m multiSink) SendTag(ctx context.Context, body []byte) error {
+	var errs []error
+	for _, s := range m {
+		if err := s.SendTag(ctx, body); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors(errs)
+}
+
+// sinkErrors is the errors of several sinks. errors.Is and errors.As match
+// any of them, without needing Go 1.20's errors.Join.
+type sinkErrors []error
+
+func joinErrors(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return sinkErrors(errs)
+}
+
+func (e sinkErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e sinkErrors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e sinkErrors) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+type shadowSink struct{ Sink }
+
+/**
+ * Returns a Sink whose failures are reported to Config.ErrorLog instead of being returned.
+ * @param {Sink} s
+ * @return Sink
+ */
+func Shadow(s Sink) Sink {
+	return shadowSink{s}
+}
+
+func (s shadowSink) SendEntry(ctx context.Context, body []byte) error {
+	if err := s.Sink.SendEntry(ctx, body); err != nil {
+		logf("quicklog: shadow sink entry failed: %v", err)
+	}
+	return nil
+}
+
+func (s shadowSink) SendTag(ctx context.Context, body []byte) error {
+	if err := s.Sink.SendTag(ctx, body); err != nil {
+		logf("quicklog: shadow sink tag failed: %v", err)
+	}
+	return nil
+}
+
+// NDJSONSink writes each entry and tag as one line of JSON, for pipelines
+// that ingest from stdout or files. Lines are {"kind":"entry","entry":{...}}
+// or {"kind":"tag","tag":{...}}, where the inner object is the body that
+// would have been sent to the API. It is safe for concurrent use.
+type NDJSONSink struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+/**
+ * Returns an NDJSONSink writing to w.
+ * @param {io.Writer} w
+ * @return *NDJSONSink
+ */
+func WriterSink(w io.Writer) *NDJSONSink {
+	return &NDJSONSink{w: w}
+}
+
+func (s *NDJSONSink) SendEntry(ctx context.Context, body []byte) error {
+	return s.writeLine(`{"kind":"entry","entry":`, body)
+}
+
+func (s *NDJSONSink) SendTag(ctx context.Context, body []byte) error {
+	return s.writeLine(`{"kind":"tag","tag":`, body)
+}
+
+func (s *NDJSONSink) writeLine(prefix string, body []byte) error {
+	line := make([]byte, 0, len(prefix)+len(body)+2)
+	line = append(line, prefix...)
+	line = append(line, body...)
+	line = append(line, "}\n"...)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.w.Write(line)
+	return err
+}
+
+/**
+ * Flushes the writer if it has a Flush method (e.g. a *bufio.Writer);
+ * otherwise does nothing.
+ * @return error
+ */
+func (s *NDJSONSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch f := s.w.(type) {
+	case interface{ Flush() error }:
+		return f.Flush()
+	case interface{ Flush() }:
+		f.Flush()
+	}
+	return nil
+}
+
+/**
+ * Flushes the writer as Flush does. The writer itself is left open.
+ * @return error
+ */
+func (s *NDJSONSink) Close() error {
+	return s.Flush()
+}
@@ -0,0 +1,144 @@
+package quicklog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConsoleSink(t *testing.T) {
+	var out bytes.Buffer
+	configureTest(t, nil, Config{Sink: &ConsoleSink{W: &out}})
+	published := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	traceCtx := TraceCtx("", "", "")
+	err := Log(Entry{
+		Published: published,
+		Level:     LevelWarn,
+		Action:    "a-type",
+		Object:    "object:1",
+		Target:    "target:2",
+		Extra:     map[string]interface{}{"b": map[string]interface{}{"c": 1}, "a": "x"},
+		Ctx:       traceCtx,
+		Tags:      []string{"name:value"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %q, want an entry and a tag line", out.String())
+	}
+	if want := `2024-01-02T15:04:05Z WARN a-type object:1 -> target:2 [a=x b={"c":1}]`; lines[0] != want {
+		t.Errorf("got entry line %q, want %q", lines[0], want)
+	}
+	if !strings.HasSuffix(lines[1], " tag "+traceCtx.TraceID+" {name:value}") {
+		t.Errorf("got tag line %q", lines[1])
+	}
+}
+
+func TestConsoleSinkColor(t *testing.T) {
+	var out bytes.Buffer
+	configureTest(t, nil, Config{Sink: &ConsoleSink{W: &out, Color: true}})
+	if err := Log(Entry{Action: "a-type", Ctx: TraceCtx("", "", "")}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), colorBold+"a-type"+colorReset) {
+		t.Errorf("got %q, want a bold action", out.String())
+	}
+}
+
+func TestConsoleSinkWithFieldNames(t *testing.T) {
+	var out bytes.Buffer
+	configureTest(t, nil, Config{
+		Sink:       &ConsoleSink{W: &out},
+		FieldNames: map[string]string{"type": "event_type"},
+		Envelope:   func(body interface{}) interface{} { return map[string]interface{}{"payload": body} },
+	})
+	if err := Log(Entry{Action: "a-type", Object: "object:1", Ctx: TraceCtx("", "", "")}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), " a-type object:1\n") {
+		t.Errorf("got %q, want the entry as logged", out.String())
+	}
+}
+
+// failingSink fails every send.
+type failingSink struct{ err error }
+
+func (s failingSink) SendEntry(ctx context.Context, body []byte) error { return s.err }
+func (s failingSink) SendTag(ctx context.Context, body []byte) error   { return s.err }
+
+func TestMultiSink(t *testing.T) {
+	first, second := &recordingSink{}, &recordingSink{}
+	failure := errors.New("backend down")
+	configureTest(t, nil, Config{Sink: MultiSink(first, failingSink{failure}, second)})
+	err := Log(Entry{Action: "a", Ctx: TraceCtx("", "", "")})
+	if !errors.Is(err, failure) {
+		t.Errorf("got %v, want the failing sink's error", err)
+	}
+	if len(first.entries) != 1 || len(second.entries) != 1 {
+		t.Errorf("sinks got %d and %d entries, want 1 each", len(first.entries), len(second.entries))
+	}
+}
+
+func TestShadow(t *testing.T) {
+	var logged bytes.Buffer
+	sink := &recordingSink{}
+	configureTest(t, nil, Config{
+		Sink:     MultiSink(sink, Shadow(failingSink{errors.New("backend down")})),
+		ErrorLog: log.New(&logged, "", 0),
+	})
+	if err := Log(Entry{Action: "a", Ctx: TraceCtx("", "", ""), Tags: []string{"t"}}); err != nil {
+		t.Errorf("a shadow sink's failure was returned: %v", err)
+	}
+	if len(sink.entries) != 1 {
+		t.Errorf("got %d entries, want 1", len(sink.entries))
+	}
+	if got := logged.String(); !strings.Contains(got, "shadow sink entry failed: backend down") || !strings.Contains(got, "shadow sink tag failed") {
+		t.Errorf("got log %q", got)
+	}
+}
+
+func TestWriterSink(t *testing.T) {
+	var out bytes.Buffer
+	buffered := bufio.NewWriter(&out)
+	sink := WriterSink(buffered)
+	configureTest(t, nil, Config{Sink: sink})
+	traceCtx := TraceCtx("", "", "")
+	if err := Log(Entry{Action: "a-type", Ctx: traceCtx, Tags: []string{"t"}}); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 0 {
+		t.Fatalf("got %q before Flush", out.String())
+	}
+	if err := sink.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %q, want an entry and a tag line", out.String())
+	}
+	var entry struct {
+		Kind  string
+		Entry map[string]interface{}
+	}
+	var tag struct {
+		Kind string
+		Tag  map[string]interface{}
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil || entry.Kind != "entry" || entry.Entry["type"] != "a-type" {
+		t.Errorf("got entry line %q (%v)", lines[0], err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &tag); err != nil || tag.Kind != "tag" || tag.Tag["tag"] != "t" || tag.Tag["trace_id"] != traceCtx.TraceID {
+		t.Errorf("got tag line %q (%v)", lines[1], err)
+	}
+	if err := WriterSink(&out).Close(); err != nil {
+		t.Errorf("got %v closing a writer without Flush", err)
+	}
+}
@@ -0,0 +1,82 @@
+package quicklog
+
+import (
+	"sync"
+	"time"
+)
+
+// Span is an operation in a child span, logged as one entry when it ends.
+type Span struct {
+	Ctx    Ctx
+	Action string
+
+	start    time.Time
+	mu       sync.Mutex
+	tagFuncs []func(err error) []string
+	ended    bool
+}
+
+/**
+ * Starts a span for action in a child span of parent (a new trace if its
+ * TraceID is empty). Call End to log it.
+ * @param {Ctx} parent
+ * @param {string} action
+ * @return *Span
+ */
+func StartSpan(parent Ctx, action string) *Span {
+	return &Span{Ctx: parent.Child(), Action: action, start: time.Now()}
+}
+
+/**
+ * Registers a function called by End with its error, whose tags are added to the trace.
+ * e.g. span.TagIf(func(err error) []string { if err != nil { return []string{"result:error"} }; return []string{"result:ok"} })
+ * @param {func} fn
+ */
+func (s *Span) TagIf(fn func(err error) []string) {
+	s.mu.Lock()
+	s.tagFuncs = append(s.tagFuncs, fn)
+	s.mu.Unlock()
+}
+
+/**
+ * Logs the span's entry with the time it started, extra {"duration_ms"}, plus
+ * {"error"} and the tag 'error' if err is not nil, and the tags from TagIf
+ * functions. Only the first call logs anything.
+ * @param {error} err the outcome of the operation
+ * @return error from logging the entry
+ */
+func (s *Span) End(err error) error {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return nil
+	}
+	s.ended = true
+	tagFuncs := s.tagFuncs
+	s.mu.Unlock()
+
+	extra := map[string]interface{}{
+		"duration_ms": durationMillis(s.start),
+	}
+	var tags []string
+	if err != nil {
+		extra["error"] = err.Error()
+		tags = append(tags, "error")
+	}
+	for _, fn := range tagFuncs {
+		tags = append(tags, fn(err)...)
+	}
+	return Log(Entry{Published: s.start, Action: s.Action, Extra: extra, Ctx: s.Ctx, Tags: tags})
+}
+
+// durationMillis returns the milliseconds since start. time.Now readings
+// carry a monotonic clock reading, so wall-clock changes (e.g. NTP steps)
+// during the span don't affect it; a start without one (e.g. after Round(0)
+// or unmarshaling) can't go below zero.
+func durationMillis(start time.Time) float64 {
+	d := time.Since(start)
+	if d < 0 {
+		d = 0
+	}
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,59 @@
+package quicklog
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSpanTagIf(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{})
+	outcome := func(err error) []string {
+		if err != nil {
+			return []string{"result:error"}
+		}
+		return []string{"result:ok"}
+	}
+	parent := TraceCtx("", "", "")
+	ok := StartSpan(parent, "ok")
+	ok.TagIf(outcome)
+	failed := StartSpan(parent, "failed")
+	failed.TagIf(outcome)
+	if err := ok.End(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := failed.End(errors.New("boom")); err != nil {
+		t.Fatal(err)
+	}
+	if err := failed.End(nil); err != nil || len(s.Entries()) != 2 {
+		t.Errorf("a second End logged again: %v, %d entries", err, len(s.Entries()))
+	}
+
+	var tags []string
+	for _, tag := range s.Tags() {
+		tags = append(tags, tag["tag"].(string))
+	}
+	if len(tags) != 3 || tags[0] != "result:ok" || tags[1] != "error" || tags[2] != "result:error" {
+		t.Errorf("got tags %v", tags)
+	}
+	if e := s.Entries()[0]; e["parent_span_id"] != parent.SpanID || e["span_id"] != ok.Ctx.SpanID {
+		t.Errorf("got %v, want a child span of %+v", e, parent)
+	}
+}
+
+func TestDurationMillis(t *testing.T) {
+	// Round(0) strips the monotonic reading, leaving only the wall clock.
+	start := time.Now()
+	wallStart := start.Round(0)
+	time.Sleep(20 * time.Millisecond)
+	monotonic, wall := durationMillis(start), durationMillis(wallStart)
+	if monotonic < 20 || monotonic > 1000 || wall < 20 || wall > 1000 {
+		t.Errorf("got %vms (monotonic) and %vms (wall clock) for a 20ms span", monotonic, wall)
+	}
+
+	// A start after now by the wall clock, as after a step back, is clamped.
+	if d := durationMillis(time.Now().Add(time.Hour).Round(0)); d != 0 {
+		t.Errorf("got %v for a start in the future, want 0", d)
+	}
+}
@@ -0,0 +1,80 @@
+// Package sqltrace logs database queries as quicklog entries in child spans.
+//
+//	err := sqltrace.TraceQuery(traceCtx, query, func() error {
+//		_, err := db.ExecContext(ctx, query, args...)
+//		return err
+//	})
+//
+// Use a Tracer for options such as redacting the logged queries:
+//
+//	tracer := sqltrace.Tracer{Redact: sqltrace.RedactLiterals}
+//	err := tracer.TraceQuery(traceCtx, query, fn)
+package sqltrace
+
+import (
+	"regexp"
+	"time"
+
+	quicklog "github.com/quicklog-io/quicklog-go"
+)
+
+// Action is the action of the entries logged by TraceQuery.
+const Action = "sql.query"
+
+// Tracer logs queries with the options set in its fields. The zero Tracer
+// logs queries unchanged, like TraceQuery.
+type Tracer struct {
+	// Redact, when set, is applied to each query before it is logged, e.g.
+	// RedactLiterals.
+	Redact func(query string) string
+}
+
+var literals = regexp.MustCompile(`'(?:[^']|'')*'|\b\d+(?:\.\d+)?\b`)
+
+// RedactLiterals replaces quoted strings and numbers in query with '?'.
+func RedactLiterals(query string) string {
+	return literals.ReplaceAllString(query, "?")
+}
+
+/**
+ * Runs fn, which should run query, and logs an entry in a child span of
+ * traceCtx with extra {"query", "duration_ms"} plus {"error"} and the tag
+ * 'error' if fn failed.
+ * @param {quicklog.Ctx} traceCtx
+ * @param {string} query
+ * @param {func} fn
+ * @return error the error from fn, or else from logging the entry
+ */
+func TraceQuery(traceCtx quicklog.Ctx, query string, fn func() error) error {
+	return Tracer{}.TraceQuery(traceCtx, query, fn)
+}
+
+/**
+ * Same as the TraceQuery function, applying t's options.
+ * @param {quicklog.Ctx} traceCtx
+ * @param {string} query
+ * @param {func} fn
+ * @return error the error from fn, or else from logging the entry
+ */
+func (t Tracer) TraceQuery(traceCtx quicklog.Ctx, query string, fn func() error) error {
+	child := traceCtx.Child()
+	start := time.Now()
+	err := fn()
+	if t.Redact != nil {
+		query = t.Redact(query)
+	}
+	extra := map[string]interface{}{
+		"query":       query,
+		"duration_ms": float64(time.Since(start)) / float64(time.Millisecond),
+	}
+	var tags []string
+	if err != nil {
+		extra["error"] = err.Error()
+		tags = append(tags, "error")
+	}
+	logErr := quicklog.Log(quicklog.Entry{Published: start, Action: Action, Extra: extra, Ctx: child, Tags: tags})
+	if err != nil {
+		return err
+	}
+	return logErr
+}
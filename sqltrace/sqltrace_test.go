@@ -0,0 +1,62 @@
+package sqltrace
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	quicklog "github.com/quicklog-io/quicklog-go"
+)
+
+func TestRedactLiterals(t *testing.T) {
+	got := RedactLiterals("SELECT * FROM users WHERE name = 'O''Brien' AND age > 42 AND t2.id = 1.5")
+	if want := "SELECT * FROM users WHERE name = ? AND age > ? AND t2.id = ?"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTraceQuery(t *testing.T) {
+	var out bytes.Buffer
+	quicklog.Configure(quicklog.Config{ProjectID: 1, Sink: quicklog.WriterSink(&out)})
+	defer quicklog.Configure(quicklog.Config{})
+	tracer := Tracer{Redact: RedactLiterals}
+
+	parent := quicklog.TraceCtx("", "", "")
+	failure := errors.New("no such table")
+	if err := tracer.TraceQuery(parent, "SELECT 1", func() error { return failure }); err != failure {
+		t.Errorf("got %v, want fn's error", err)
+	}
+
+	var line struct {
+		Entry map[string]interface{} `json:"entry"`
+	}
+	if err := json.Unmarshal([]byte(strings.SplitN(out.String(), "\n", 2)[0]), &line); err != nil {
+		t.Fatal(err)
+	}
+	e := line.Entry
+	extra := e["context"].(map[string]interface{})
+	if e["type"] != Action || e["trace_id"] != parent.TraceID || e["parent_span_id"] != parent.SpanID {
+		t.Errorf("got entry %v", e)
+	}
+	if extra["query"] != "SELECT ?" || extra["error"] != "no such table" {
+		t.Errorf("got extra %v", extra)
+	}
+	if !strings.Contains(out.String(), `"tag":"error"`) {
+		t.Errorf("no error tag in %s", out.String())
+	}
+}
+
+func TestTraceQueryLogsQueryUnchanged(t *testing.T) {
+	var out bytes.Buffer
+	quicklog.Configure(quicklog.Config{ProjectID: 1, Sink: quicklog.WriterSink(&out)})
+	defer quicklog.Configure(quicklog.Config{})
+
+	if err := TraceQuery(quicklog.TraceCtx("", "", ""), "SELECT 1", func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `"query":"SELECT 1"`) {
+		t.Errorf("query not logged unchanged in %s", out.String())
+	}
+}
@@ -0,0 +1,43 @@
+package quicklog
+
+import (
+	"context"
+	"encoding/json"
+)
+
+const refKey = "_ref"
+
+// A LargeValueStore stores an oversized extra value and returns a URL referencing it.
+type LargeValueStore interface {
+	Put(ctx context.Context, key string, value []byte) (url string, err error)
+}
+
+// storeLargeValues replaces the oversized values in extra with references.
+// Keys are 'spanID/uniqueID/extraKey': the span ID groups an entry's values,
+// and the generated ID keeps entries logged with the same Ctx from
+// overwriting each other's values.
+func storeLargeValues(ctx context.Context, cfg *settings, spanID string, extra map[string]interface{}) error {
+	threshold := cfg.LargeValueThreshold
+	if threshold <= 0 {
+		threshold = 4096
+	}
+	entryID := GenerateID()
+	for k, v := range extra {
+		if k == hostKey {
+			continue
+		}
+		value, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if len(value) <= threshold {
+			continue
+		}
+		url, err := cfg.LargeValueStore.Put(ctx, spanID+"/"+entryID+"/"+k, value)
+		if err != nil {
+			return err
+		}
+		extra[k] = map[string]string{refKey: url}
+	}
+	return nil
+}
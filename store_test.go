@@ -0,0 +1,57 @@
+package quicklog
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memoryStore struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func (m *memoryStore) Put(ctx context.Context, key string, value []byte) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.values == nil {
+		m.values = make(map[string]string)
+	}
+	m.values[key] = string(value)
+	return "mem://" + key, nil
+}
+
+func TestLargeValuesAreStoredByReference(t *testing.T) {
+	s := newTestServer(t)
+	store := &memoryStore{}
+	configureTest(t, s, Config{LargeValueStore: store, LargeValueThreshold: 10})
+
+	traceCtx := TraceCtx("", "", "")
+	for _, body := range []string{"first large value", "second large value"} {
+		extra := map[string]interface{}{"body": body, "small": "x"}
+		if err := Quicklog(time.Now(), "upload", "", "", extra, traceCtx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries := s.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	for i, want := range []string{`"first large value"`, `"second large value"`} {
+		extra := entries[i]["context"].(map[string]interface{})
+		if extra["small"] != "x" {
+			t.Errorf("small value was moved: %v", extra)
+		}
+		ref := extra["body"].(map[string]interface{})[refKey].(string)
+		key := strings.TrimPrefix(ref, "mem://")
+		if !strings.HasPrefix(key, traceCtx.SpanID+"/") {
+			t.Errorf("key %q isn't under the span ID", key)
+		}
+		if got := store.values[key]; got != want {
+			t.Errorf("entry %d references %s, want %s", i, got, want)
+		}
+	}
+}
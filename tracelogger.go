@@ -0,0 +1,39 @@
+package quicklog
+
+import "time"
+
+// TraceLogger logs entries and tags for a single trace without passing its Ctx every time.
+type TraceLogger struct {
+	Ctx Ctx
+	// ChildSpans logs each entry in a new child span of Ctx rather than in Ctx's own span.
+	ChildSpans bool
+}
+
+/**
+ * Returns a TraceLogger bound to traceCtx, logging each entry in a child span.
+ * @param {Ctx} traceCtx
+ * @return *TraceLogger
+ */
+func ForTrace(traceCtx Ctx) *TraceLogger {
+	return &TraceLogger{Ctx: traceCtx, ChildSpans: true}
+}
+
+/**
+ * Creates a quicklog entry, published now, in the bound trace.
+ * @return error
+ */
+func (l *TraceLogger) Log(action, object, target string, extra map[string]interface{}, tags ...string) error {
+	traceCtx := l.Ctx
+	if l.ChildSpans {
+		traceCtx = traceCtx.Child()
+	}
+	return Log(Entry{Published: time.Now(), Action: action, Object: object, Target: target, Extra: extra, Ctx: traceCtx, Tags: tags})
+}
+
+/**
+ * Associates tags with the bound trace.
+ * @return error
+ */
+func (l *TraceLogger) Tag(tags ...string) error {
+	return TagTrace(l.Ctx.TraceID, tags...)
+}
@@ -0,0 +1,33 @@
+package quicklog
+
+import "testing"
+
+func TestTraceLogger(t *testing.T) {
+	s := newTestServer(t)
+	configureTest(t, s, Config{})
+	traceCtx := TraceCtx("user:1", "", "")
+	l := ForTrace(traceCtx)
+	if err := l.Log("a", "object:1", "", nil, "t1"); err != nil {
+		t.Fatal(err)
+	}
+	l.ChildSpans = false
+	if err := l.Log("b", "", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Tag("t2"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := s.Entries()
+	child, own := entries[0], entries[1]
+	if child["trace_id"] != traceCtx.TraceID || child["parent_span_id"] != traceCtx.SpanID || child["actor"] != "user:1" {
+		t.Errorf("got %v, want a child span of %+v", child, traceCtx)
+	}
+	if own["span_id"] != traceCtx.SpanID {
+		t.Errorf("got %v, want the bound span", own)
+	}
+	tags := s.Tags()
+	if len(tags) != 2 || tags[1]["trace_id"] != traceCtx.TraceID || tags[1]["tag"] != "t2" {
+		t.Errorf("got tags %v", tags)
+	}
+}